@@ -18,6 +18,9 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"fmt"
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -28,14 +31,22 @@ import (
 const (
 	// A ConditionKindAllocationReady indicates whether the allocation is ready.
 	ConditionKindReady nddv1.ConditionKind = "Ready"
+	// A ConditionKindCapacityWarning indicates whether the allocations crossed the warning threshold.
+	ConditionKindCapacityWarning nddv1.ConditionKind = "CapacityWarning"
+	// A ConditionKindExhausted indicates whether the allocations crossed the critical threshold.
+	ConditionKindExhausted nddv1.ConditionKind = "Exhausted"
 )
 
 // ConditionReasons a package is or is not installed.
 const (
-	ConditionReasonReady        nddv1.ConditionReason = "Ready"
-	ConditionReasonNotReady     nddv1.ConditionReason = "NotReady"
-	ConditionReasonAllocating   nddv1.ConditionReason = "Allocating"
-	ConditionReasonDeAllocating nddv1.ConditionReason = "DeAllocating"
+	ConditionReasonReady           nddv1.ConditionReason = "Ready"
+	ConditionReasonNotReady        nddv1.ConditionReason = "NotReady"
+	ConditionReasonAllocating      nddv1.ConditionReason = "Allocating"
+	ConditionReasonDeAllocating    nddv1.ConditionReason = "DeAllocating"
+	ConditionReasonOdaNotFound     nddv1.ConditionReason = "OdaNotFound"
+	ConditionReasonDeletionBlocked nddv1.ConditionReason = "DeletionBlocked"
+	ConditionReasonAboveThreshold  nddv1.ConditionReason = "AboveThreshold"
+	ConditionReasonBelowThreshold  nddv1.ConditionReason = "BelowThreshold"
 )
 
 // Ready indicates that the resource is ready.
@@ -57,3 +68,75 @@ func NotReady() nddv1.Condition {
 		Reason:             ConditionReasonNotReady,
 	}
 }
+
+// OdaNotFound indicates that the resource is not ready since its organization,
+// deployment or availability zone does not exist in the org registry.
+func OdaNotFound(err error) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonOdaNotFound,
+		Message:            err.Error(),
+	}
+}
+
+// DeletionBlocked indicates that the deletion of the resource is blocked by
+// the registrations which are still allocated.
+func DeletionBlocked(registrants []string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonDeletionBlocked,
+		Message:            fmt.Sprintf("deletion blocked by %d registrations: %s", len(registrants), strings.Join(registrants, ", ")),
+	}
+}
+
+// CapacityWarning indicates that the allocations of the resource crossed the
+// warning threshold.
+func CapacityWarning(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCapacityWarning,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonAboveThreshold,
+		Message:            msg,
+	}
+}
+
+// CapacityOK indicates that the allocations of the resource are below the
+// warning threshold.
+func CapacityOK(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindCapacityWarning,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonBelowThreshold,
+		Message:            msg,
+	}
+}
+
+// Exhausted indicates that the allocations of the resource crossed the
+// critical threshold.
+func Exhausted(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindExhausted,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonAboveThreshold,
+		Message:            msg,
+	}
+}
+
+// NotExhausted indicates that the allocations of the resource are below the
+// critical threshold.
+func NotExhausted(msg string) nddv1.Condition {
+	return nddv1.Condition{
+		Kind:               ConditionKindExhausted,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ConditionReasonBelowThreshold,
+		Message:            msg,
+	}
+}
@@ -56,6 +56,9 @@ type Rr interface {
 	GetDeployment() string
 	GetAvailabilityZone() string
 	GetRegistryName() string
+	GetRegistryNamespace() string
+	GetStatusRegistryName() string
+	HasOda() bool
 	GetSourceTag() map[string]string
 	GetSelector() map[string]string
 	SetNi(uint32)
@@ -76,22 +79,66 @@ func (x *Register) SetConditions(c ...nddv1.Condition) {
 	x.Status.SetConditions(c...)
 }
 
+// GetOrganization returns the organization of the spec oda, and falls back to
+// the organization encoded in the odns name of the register
 func (x *Register) GetOrganization() string {
+	if x.HasOda() {
+		return x.Spec.GetOrganization()
+	}
 	return odns.Name2OdnsRegistry(x.GetName()).GetOrganization()
 }
 
 func (x *Register) GetDeployment() string {
+	if x.HasOda() {
+		return x.Spec.GetDeployment()
+	}
 	return odns.Name2OdnsRegistry(x.GetName()).GetDeployment()
 }
 
 func (x *Register) GetAvailabilityZone() string {
+	if x.HasOda() {
+		return x.Spec.GetAvailabilityZone()
+	}
 	return odns.Name2OdnsRegistry(x.GetName()).GetAvailabilityZone()
 }
 
+// HasOda reports if the spec selects the registry by oda
+func (x *Register) HasOda() bool {
+	return x.Spec.GetOrganization() != ""
+}
+
+// GetRegistryName returns the registry-name of the spec, and falls back to the
+// registry name encoded in the odns name of the register. The name is empty when
+// the registry is selected by oda.
 func (x *Register) GetRegistryName() string {
+	if !reflect.ValueOf(x.Spec.RegistryName).IsZero() {
+		return *x.Spec.RegistryName
+	}
+	if x.HasOda() {
+		// the registry is resolved by oda
+		return ""
+	}
 	return odns.Name2OdnsRegistry(x.GetName()).GetRegistryName()
 }
 
+// GetStatusRegistryName returns the name of the registry the register was
+// last allocated from
+func (x *Register) GetStatusRegistryName() string {
+	if x.Status.RegistryName == nil {
+		return ""
+	}
+	return *x.Status.RegistryName
+}
+
+// GetRegistryNamespace returns the registry-namespace of the spec, and falls
+// back to the namespace of the register
+func (x *Register) GetRegistryNamespace() string {
+	if !reflect.ValueOf(x.Spec.RegistryNamespace).IsZero() {
+		return *x.Spec.RegistryNamespace
+	}
+	return x.GetNamespace()
+}
+
 func (n *Register) GetSourceTag() map[string]string {
 	s := make(map[string]string)
 	if reflect.ValueOf(n.Spec.Register.SourceTag).IsZero() {
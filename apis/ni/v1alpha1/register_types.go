@@ -49,9 +49,15 @@ type NiRegister struct {
 
 // A RegisterSpec defines the desired state of a Register.
 type RegisterSpec struct {
-	//nddov1.OdaInfo `json:",inline"`
-	//RegistryName   *string     `json:"registry-name"`
-	Register *NiRegister `json:"register,omitempty"`
+	// OdaInfo selects the registry by organization, deployment and availability-zone
+	// when no registry-name is set
+	nddov1.OdaInfo `json:",inline"`
+	// RegistryName is the name of the registry to register with, when not set the
+	// registry name is derived from the odns name of the register
+	RegistryName *string `json:"registry-name,omitempty"`
+	// RegistryNamespace is the namespace of the registry, defaults to the namespace of the register
+	RegistryNamespace *string     `json:"registry-namespace,omitempty"`
+	Register          *NiRegister `json:"register,omitempty"`
 }
 
 // A RegisterStatus represents the observed state of a Register.
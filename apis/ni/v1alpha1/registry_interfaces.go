@@ -21,6 +21,7 @@ import (
 	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
 	"github.com/yndd/ndd-runtime/pkg/utils"
 	"github.com/yndd/nddo-runtime/pkg/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -59,8 +60,21 @@ type Rg interface {
 	GetSize() uint32
 	GetAllocations() uint32
 	GetAllocatedNis() []*string
+	GetStatusDetail() string
+	GetStatusMaxEntries() uint32
+	GetOverflow() *NddrRegistryOverflow
+	GetLedger() string
+	GetLedgerRef() *NddrRegistryLedger
+	GetAllowedNamespaces() []string
+	GetAllowedNamespaceSelector() *metav1.LabelSelector
+	GetDeletionPolicy() string
+	GetCapacityWarning() uint32
+	GetCapacityCritical() uint32
+	GetCapacityHysteresis() uint32
 	InitializeResource() error
 	SetStatus(uint32, []*string)
+	SetAllocations([]*NddrRegistryAllocation, *NddrRegistryOverflow)
+	SetLedgerRef(*NddrRegistryLedger)
 	SetOrganization(string)
 	SetDeployment(string)
 	SetAvailabilityZone(s string)
@@ -118,6 +132,83 @@ func (x *Registry) GetAllocatedNis() []*string {
 	return x.Status.Registry.State.Used
 }
 
+func (x *Registry) GetStatusDetail() string {
+	if reflect.ValueOf(x.Spec.Registry.StatusDetail).IsZero() {
+		return StatusDetailSummary
+	}
+	return *x.Spec.Registry.StatusDetail
+}
+
+func (x *Registry) GetStatusMaxEntries() uint32 {
+	if reflect.ValueOf(x.Spec.Registry.StatusMaxEntries).IsZero() {
+		return DefaultStatusMaxEntries
+	}
+	return *x.Spec.Registry.StatusMaxEntries
+}
+
+func (x *Registry) GetOverflow() *NddrRegistryOverflow {
+	if x.Status.Registry != nil && x.Status.Registry.State != nil {
+		return x.Status.Registry.State.Overflow
+	}
+	return nil
+}
+
+func (x *Registry) GetLedger() string {
+	if reflect.ValueOf(x.Spec.Registry.Ledger).IsZero() {
+		return LedgerStatus
+	}
+	return *x.Spec.Registry.Ledger
+}
+
+func (x *Registry) GetLedgerRef() *NddrRegistryLedger {
+	if x.Status.Registry != nil && x.Status.Registry.State != nil {
+		return x.Status.Registry.State.Ledger
+	}
+	return nil
+}
+
+func (x *Registry) GetAllowedNamespaces() []string {
+	namespaces := make([]string, 0, len(x.Spec.Registry.AllowedNamespaces))
+	for _, ns := range x.Spec.Registry.AllowedNamespaces {
+		if ns != nil {
+			namespaces = append(namespaces, *ns)
+		}
+	}
+	return namespaces
+}
+
+func (x *Registry) GetAllowedNamespaceSelector() *metav1.LabelSelector {
+	return x.Spec.Registry.AllowedNamespaceSelector
+}
+
+func (x *Registry) GetDeletionPolicy() string {
+	if reflect.ValueOf(x.Spec.Registry.DeletionPolicy).IsZero() {
+		return DeletionPolicyBlock
+	}
+	return *x.Spec.Registry.DeletionPolicy
+}
+
+func (x *Registry) GetCapacityWarning() uint32 {
+	if reflect.ValueOf(x.Spec.Registry.CapacityWarning).IsZero() {
+		return DefaultCapacityWarning
+	}
+	return *x.Spec.Registry.CapacityWarning
+}
+
+func (x *Registry) GetCapacityCritical() uint32 {
+	if reflect.ValueOf(x.Spec.Registry.CapacityCritical).IsZero() {
+		return DefaultCapacityCritical
+	}
+	return *x.Spec.Registry.CapacityCritical
+}
+
+func (x *Registry) GetCapacityHysteresis() uint32 {
+	if reflect.ValueOf(x.Spec.Registry.CapacityHysteresis).IsZero() {
+		return DefaultCapacityHysteresis
+	}
+	return *x.Spec.Registry.CapacityHysteresis
+}
+
 func (x *Registry) InitializeResource() error {
 
 	// check if the pool was already initialized
@@ -149,6 +240,15 @@ func (x *Registry) SetStatus(allocated uint32, used []*string) {
 	x.Status.Registry.State.Used = used
 }
 
+func (x *Registry) SetAllocations(allocations []*NddrRegistryAllocation, overflow *NddrRegistryOverflow) {
+	x.Status.Registry.State.Allocations = allocations
+	x.Status.Registry.State.Overflow = overflow
+}
+
+func (x *Registry) SetLedgerRef(ledger *NddrRegistryLedger) {
+	x.Status.Registry.State.Ledger = ledger
+}
+
 func (x *Registry) SetOrganization(s string) {
 	x.Status.SetOrganization(s)
 }
@@ -25,6 +25,35 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
+const (
+	// StatusDetailSummary reports only the allocation counters and used ni names in the status
+	StatusDetailSummary = "summary"
+	// StatusDetailDetailed reports the index, key and registrants of every allocation in the status
+	StatusDetailDetailed = "detailed"
+	// DefaultStatusMaxEntries is the default amount of allocations reported in the status
+	DefaultStatusMaxEntries = 100
+	// LedgerStatus keeps the allocation ledger in the status of the registry
+	LedgerStatus = "status"
+	// LedgerConfigMap keeps the allocation ledger in configmaps sharded by index,
+	// the status only reports the counters and a reference to the ledger
+	LedgerConfigMap = "configmap"
+	// DeletionPolicyBlock blocks the deletion of the registry as long as it has registrations
+	DeletionPolicyBlock = "block"
+	// DeletionPolicyOrphan drops the pool on deletion and leaves the registers behind
+	DeletionPolicyOrphan = "orphan"
+	// DeletionPolicyCascade deletes the registers and releases all allocations on deletion
+	DeletionPolicyCascade = "cascade"
+	// DefaultCapacityWarning is the default allocated percentage of the pool from
+	// which the capacity warning condition is set
+	DefaultCapacityWarning = 80
+	// DefaultCapacityCritical is the default allocated percentage of the pool from
+	// which the exhausted condition is set
+	DefaultCapacityCritical = 95
+	// DefaultCapacityHysteresis is the default percentage below a threshold the
+	// allocations have to drop before the condition is cleared
+	DefaultCapacityHysteresis = 5
+)
+
 // Registry struct
 type RegistryRegistry struct {
 	// +kubebuilder:validation:Enum=`disable`;`enable`
@@ -41,6 +70,43 @@ type RegistryRegistry struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Pattern="[A-Za-z0-9 !@#$^&()|+=`~.,'/_:;?-]*"
 	Description *string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=`summary`;`detailed`
+	// +kubebuilder:default:="summary"
+	StatusDetail *string `json:"status-detail,omitempty"`
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	// +kubebuilder:default:=100
+	StatusMaxEntries *uint32 `json:"status-max-entries,omitempty"`
+	// +kubebuilder:validation:Enum=`status`;`configmap`
+	// +kubebuilder:default:="status"
+	Ledger *string `json:"ledger,omitempty"`
+	// AllowedNamespaces are the namespaces, besides the namespace of the registry,
+	// which may allocate from the registry
+	AllowedNamespaces []*string `json:"allowed-namespaces,omitempty"`
+	// AllowedNamespaceSelector selects the namespaces by label which may allocate
+	// from the registry
+	AllowedNamespaceSelector *metav1.LabelSelector `json:"allowed-namespace-selector,omitempty"`
+	// +kubebuilder:validation:Enum=`block`;`orphan`;`cascade`
+	// +kubebuilder:default:="block"
+	DeletionPolicy *string `json:"deletion-policy,omitempty"`
+	// CapacityWarning is the allocated percentage of the pool from which the
+	// CapacityWarning condition is set, 0 disables the condition
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default:=80
+	CapacityWarning *uint32 `json:"capacity-warning,omitempty"`
+	// CapacityCritical is the allocated percentage of the pool from which the
+	// Exhausted condition is set, 0 disables the condition
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default:=95
+	CapacityCritical *uint32 `json:"capacity-critical,omitempty"`
+	// CapacityHysteresis is the percentage below a threshold the allocations
+	// have to drop before its condition is cleared
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +kubebuilder:default:=5
+	CapacityHysteresis *uint32 `json:"capacity-hysteresis,omitempty"`
 }
 
 // A RegistrySpec defines the desired state of a Registry.
@@ -37,6 +37,39 @@ type NddrRegistryRegistryState struct {
 	Allocated *uint32   `json:"allocated,omitempty"`
 	Available *uint32   `json:"available,omitempty"`
 	Used      []*string `json:"used,omitempty"`
+	// Allocations are only reported with status-detail detailed
+	Allocations []*NddrRegistryAllocation `json:"allocations,omitempty"`
+	// Overflow refers to the allocations which did not fit in the status
+	Overflow *NddrRegistryOverflow `json:"overflow,omitempty"`
+	// Ledger refers to the configmaps holding the allocations with ledger configmap
+	Ledger *NddrRegistryLedger `json:"ledger,omitempty"`
+}
+
+// NddrRegistryAllocation struct
+type NddrRegistryAllocation struct {
+	Index           *uint32 `json:"index,omitempty"`
+	Key             *string `json:"key,omitempty"`
+	RegistrantCount *uint32 `json:"registrant-count,omitempty"`
+	// Registrants lists the first registrants in order, registrant-count
+	// holds the amount of registrants
+	Registrants []*string `json:"registrants,omitempty"`
+}
+
+// NddrRegistryOverflow struct
+type NddrRegistryOverflow struct {
+	Entries *uint32 `json:"entries,omitempty"`
+	// ConfigMapPrefix is the name prefix of the shards, a shard is named <prefix>-<shard>
+	ConfigMapPrefix *string `json:"config-map-prefix,omitempty"`
+	Shards          *uint32 `json:"shards,omitempty"`
+	ShardSize       *uint32 `json:"shard-size,omitempty"`
+}
+
+// NddrRegistryLedger struct
+type NddrRegistryLedger struct {
+	// ConfigMapPrefix is the name prefix of the shards, a shard is named <prefix>-<shard>
+	ConfigMapPrefix *string `json:"config-map-prefix,omitempty"`
+	Shards          *uint32 `json:"shards,omitempty"`
+	ShardSize       *uint32 `json:"shard-size,omitempty"`
 }
 
 // Root is the root of the schema
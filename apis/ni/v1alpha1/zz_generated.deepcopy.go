@@ -23,6 +23,7 @@ package v1alpha1
 
 import (
 	"github.com/yndd/nddo-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -93,6 +94,112 @@ func (in *NddrRegistry) DeepCopy() *NddrRegistry {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NddrRegistryAllocation) DeepCopyInto(out *NddrRegistryAllocation) {
+	*out = *in
+	if in.Index != nil {
+		in, out := &in.Index, &out.Index
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Key != nil {
+		in, out := &in.Key, &out.Key
+		*out = new(string)
+		**out = **in
+	}
+	if in.RegistrantCount != nil {
+		in, out := &in.RegistrantCount, &out.RegistrantCount
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Registrants != nil {
+		in, out := &in.Registrants, &out.Registrants
+		*out = make([]*string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(string)
+				**out = **in
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrRegistryAllocation.
+func (in *NddrRegistryAllocation) DeepCopy() *NddrRegistryAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(NddrRegistryAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NddrRegistryLedger) DeepCopyInto(out *NddrRegistryLedger) {
+	*out = *in
+	if in.ConfigMapPrefix != nil {
+		in, out := &in.ConfigMapPrefix, &out.ConfigMapPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Shards != nil {
+		in, out := &in.Shards, &out.Shards
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.ShardSize != nil {
+		in, out := &in.ShardSize, &out.ShardSize
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrRegistryLedger.
+func (in *NddrRegistryLedger) DeepCopy() *NddrRegistryLedger {
+	if in == nil {
+		return nil
+	}
+	out := new(NddrRegistryLedger)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NddrRegistryOverflow) DeepCopyInto(out *NddrRegistryOverflow) {
+	*out = *in
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.ConfigMapPrefix != nil {
+		in, out := &in.ConfigMapPrefix, &out.ConfigMapPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.Shards != nil {
+		in, out := &in.Shards, &out.Shards
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.ShardSize != nil {
+		in, out := &in.ShardSize, &out.ShardSize
+		*out = new(uint32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrRegistryOverflow.
+func (in *NddrRegistryOverflow) DeepCopy() *NddrRegistryOverflow {
+	if in == nil {
+		return nil
+	}
+	out := new(NddrRegistryOverflow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NddrRegistryRegistry) DeepCopyInto(out *NddrRegistryRegistry) {
 	*out = *in
@@ -167,6 +274,27 @@ func (in *NddrRegistryRegistryState) DeepCopyInto(out *NddrRegistryRegistryState
 			}
 		}
 	}
+	if in.Allocations != nil {
+		in, out := &in.Allocations, &out.Allocations
+		*out = make([]*NddrRegistryAllocation, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(NddrRegistryAllocation)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.Overflow != nil {
+		in, out := &in.Overflow, &out.Overflow
+		*out = new(NddrRegistryOverflow)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ledger != nil {
+		in, out := &in.Ledger, &out.Ledger
+		*out = new(NddrRegistryLedger)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NddrRegistryRegistryState.
@@ -278,6 +406,17 @@ func (in *RegisterList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RegisterSpec) DeepCopyInto(out *RegisterSpec) {
 	*out = *in
+	in.OdaInfo.DeepCopyInto(&out.OdaInfo)
+	if in.RegistryName != nil {
+		in, out := &in.RegistryName, &out.RegistryName
+		*out = new(string)
+		**out = **in
+	}
+	if in.RegistryNamespace != nil {
+		in, out := &in.RegistryNamespace, &out.RegistryNamespace
+		*out = new(string)
+		**out = **in
+	}
 	if in.Register != nil {
 		in, out := &in.Register, &out.Register
 		*out = new(NiRegister)
@@ -404,6 +543,57 @@ func (in *RegistryRegistry) DeepCopyInto(out *RegistryRegistry) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.StatusDetail != nil {
+		in, out := &in.StatusDetail, &out.StatusDetail
+		*out = new(string)
+		**out = **in
+	}
+	if in.StatusMaxEntries != nil {
+		in, out := &in.StatusMaxEntries, &out.StatusMaxEntries
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.Ledger != nil {
+		in, out := &in.Ledger, &out.Ledger
+		*out = new(string)
+		**out = **in
+	}
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]*string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(string)
+				**out = **in
+			}
+		}
+	}
+	if in.AllowedNamespaceSelector != nil {
+		in, out := &in.AllowedNamespaceSelector, &out.AllowedNamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(string)
+		**out = **in
+	}
+	if in.CapacityWarning != nil {
+		in, out := &in.CapacityWarning, &out.CapacityWarning
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.CapacityCritical != nil {
+		in, out := &in.CapacityCritical, &out.CapacityCritical
+		*out = new(uint32)
+		**out = **in
+	}
+	if in.CapacityHysteresis != nil {
+		in, out := &in.CapacityHysteresis, &out.CapacityHysteresis
+		*out = new(uint32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegistryRegistry.
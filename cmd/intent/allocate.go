@@ -0,0 +1,188 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+)
+
+var (
+	selector  map[string]string
+	sourceTag map[string]string
+)
+
+// allocation is the result of an allocate command
+type allocation struct {
+	Registry   string            `json:"registry"`
+	Registrant string            `json:"registrant"`
+	Name       string            `json:"name"`
+	Index      uint32            `json:"index"`
+	SourceTag  map[string]string `json:"source-tag,omitempty"`
+}
+
+// allocateCmd allocates an ni index from a running server
+var allocateCmd = &cobra.Command{
+	Use:   "allocate REGISTRANT",
+	Short: "allocate an ni index",
+	Long:  "allocate an ni index for the registrant, e.g. allocate leaf1-blue --registry nokia-default --selector name=blue --source-tag node=leaf1",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, ok := selector["name"]; !ok {
+			return errors.New("the selector requires a name, e.g. --selector name=blue")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		reply, err := client.ResourceRequest(ctx, &resourcepb.Request{
+			Namespace:    clientNamespace,
+			RegistryName: registryName,
+			Name:         args[0],
+			Request: &resourcepb.Req{
+				Selector:  selector,
+				SourceTag: sourceTag,
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "allocate failed")
+		}
+		index, err := strconv.ParseUint(replyString(reply, "index"), 10, 32)
+		if err != nil {
+			return errors.Wrap(err, "invalid index in reply")
+		}
+
+		a := &allocation{
+			Registry:   strings.Join([]string{clientNamespace, registryName}, "."),
+			Registrant: args[0],
+			Name:       selector["name"],
+			Index:      uint32(index),
+			SourceTag:  sourceTag,
+		}
+		if output != outputTable {
+			return printObject(os.Stdout, a)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REGISTRY\tINDEX\tNI\tREGISTRANT")
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", a.Registry, a.Index, a.Name, a.Registrant)
+		return tw.Flush()
+	},
+}
+
+// releaseCmd releases an ni index of a registrant, or in bulk by source-tag label selector
+var releaseCmd = &cobra.Command{
+	Use:   "release [REGISTRANT]",
+	Short: "release an ni index",
+	Long:  "release the ni index of the registrant, e.g. release leaf1-blue --registry nokia-default --selector name=blue, or all registrations matching --source-tag-selector",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		req := &resourcepb.Request{
+			Namespace:    clientNamespace,
+			RegistryName: registryName,
+			Request: &resourcepb.Req{
+				Selector:  selector,
+				SourceTag: sourceTag,
+			},
+		}
+		switch {
+		case sourceTagSelector != "":
+			req.Request.Selector = map[string]string{"source-tag-selector": sourceTagSelector}
+		case len(args) == 1:
+			if _, ok := selector["name"]; !ok {
+				return errors.New("the selector requires a name, e.g. --selector name=blue")
+			}
+			req.Name = args[0]
+		default:
+			return errors.New("specify a registrant or a --source-tag-selector")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		reply, err := client.ResourceRelease(ctx, req)
+		if err != nil {
+			return errors.Wrap(err, "release failed")
+		}
+
+		result := &handler.ReleaseResult{
+			Freed:       make([]string, 0),
+			Retained:    make([]string, 0),
+			Registrants: make([]string, 0),
+		}
+		if sourceTagSelector == "" {
+			result.Registrants = append(result.Registrants, args[0])
+		} else {
+			for key, v := range map[string]*[]string{
+				"freed":       &result.Freed,
+				"retained":    &result.Retained,
+				"registrants": &result.Registrants,
+			} {
+				if data := replyString(reply, key); data != "" {
+					if err := json.Unmarshal([]byte(data), v); err != nil {
+						return errors.Wrap(err, "cannot decode release result")
+					}
+				}
+			}
+		}
+		if output != outputTable {
+			return printObject(os.Stdout, result)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REGISTRY\tRELEASED\tFREED\tRETAINED")
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", strings.Join([]string{clientNamespace, registryName}, "."),
+			strings.Join(result.Registrants, ","), strings.Join(result.Freed, ","), strings.Join(result.Retained, ","))
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(allocateCmd)
+	addClientFlags(allocateCmd)
+	addRegisterFlags(allocateCmd)
+	rootCmd.AddCommand(releaseCmd)
+	addClientFlags(releaseCmd)
+	addRegisterFlags(releaseCmd)
+	releaseCmd.Flags().StringVarP(&sourceTagSelector, "source-tag-selector", "l", "", "Release all registrations whose source tags match the label selector, e.g. node=leaf1")
+}
+
+// addRegisterFlags adds the selector and source-tag flags of a registration
+func addRegisterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringToStringVarP(&selector, "selector", "", nil, "Selector of the registration, e.g. name=blue.")
+	cmd.Flags().StringToStringVarP(&sourceTag, "source-tag", "", nil, "Source tag of the registration, e.g. node=leaf1, can be repeated.")
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"google.golang.org/grpc"
+	"sigs.k8s.io/yaml"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var (
+	serverAddress   string
+	clientTimeout   time.Duration
+	clientNamespace string
+	registryName    string
+	output          string
+)
+
+// addClientFlags adds the flags shared by all commands talking to a running server
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&serverAddress, "address", "a", "localhost:"+strconv.Itoa(pkgmetav1.GnmiServerPort), "The address of the ni-registry grpc server.")
+	cmd.Flags().DurationVarP(&clientTimeout, "timeout", "", 10*time.Second, "Timeout of the grpc request.")
+	cmd.Flags().StringVarP(&clientNamespace, "namespace", "n", "default", "Namespace of the registry.")
+	cmd.Flags().StringVarP(&registryName, "registry", "r", "", "Name of the registry.")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format: table, json or yaml.")
+}
+
+// resourceClient dials the server and returns a resource client, the returned
+// function closes the connection
+func resourceClient(ctx context.Context) (resourcepb.ResourceClient, func(), error) {
+	conn, err := grpc.DialContext(ctx, serverAddress, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot connect to %s", serverAddress)
+	}
+	return resourcepb.NewResourceClient(conn), func() { conn.Close() }, nil
+}
+
+// printEntries prints the entries per registry in the requested output format
+func printEntries(w io.Writer, result map[string][]*hash.Entry) error {
+	if output != outputTable {
+		return printObject(w, result)
+	}
+
+	crNames := make([]string, 0, len(result))
+	for crName := range result {
+		crNames = append(crNames, crName)
+	}
+	sort.Strings(crNames)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGISTRY\tINDEX\tNI\tREGISTRANT\tSOURCE-TAG")
+	for _, crName := range crNames {
+		for _, e := range result[crName] {
+			names := make([]string, 0, len(e.Register))
+			for name := range e.Register {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", crName, e.Index, e.Key, name, e.Register[name].String())
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// printObject prints the object in json or yaml output format
+func printObject(w io.Writer, obj interface{}) error {
+	var b []byte
+	var err error
+	switch output {
+	case outputJSON:
+		b, err = json.MarshalIndent(obj, "", "  ")
+	case outputYAML:
+		b, err = yaml.Marshal(obj)
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, strings.TrimSpace(string(b)))
+	return nil
+}
+
+// replyString returns the string value of a key in the reply data
+func replyString(reply *resourcepb.Reply, key string) string {
+	if v, ok := reply.GetData()[key]; ok {
+		return strings.TrimSpace(v.GetStringVal())
+	}
+	return ""
+}
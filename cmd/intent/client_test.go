@@ -0,0 +1,106 @@
+package intent
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func testEntries() map[string][]*hash.Entry {
+	return map[string][]*hash.Entry{
+		"default.rg2": {{Index: 7, Key: "red", Register: map[string]labels.Set{"reg-red": nil}}},
+		"default.rg1": {{Index: 3, Key: "blue", Register: map[string]labels.Set{
+			"reg-b": {"tenant": "t1"},
+			"reg-a": nil,
+		}}},
+	}
+}
+
+func TestPrintEntries(t *testing.T) {
+	output = outputTable
+	defer func() { output = outputTable }()
+
+	b := &bytes.Buffer{}
+	if err := printEntries(b, testEntries()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and a line per registration, got %q", lines)
+	}
+	// sorted by registry and registrant
+	for i, want := range []string{"default.rg1  3", "default.rg1  3", "default.rg2  7"} {
+		if !strings.HasPrefix(lines[i+1], want) {
+			t.Errorf("line %d: expected prefix %q, got %q", i+1, want, lines[i+1])
+		}
+	}
+	if !strings.Contains(lines[1], "reg-a") || !strings.Contains(lines[2], "tenant=t1") {
+		t.Errorf("unexpected registrations: %q", lines[1:])
+	}
+
+	output = outputJSON
+	b.Reset()
+	if err := printEntries(b, testEntries()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(b.String(), `"default.rg1"`) {
+		t.Errorf("expected json output, got %s", b.String())
+	}
+
+	output = "xml"
+	if err := printEntries(b, testEntries()); err == nil {
+		t.Errorf("an unknown output format should be refused")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	events := watchEvents(testEntries())
+	if len(events) != 3 {
+		t.Fatalf("expected an event per registration, got %d", len(events))
+	}
+	e, ok := events["default.rg1/3/reg-b"]
+	if !ok || e.Name != "blue" || e.SourceTag["tenant"] != "t1" {
+		t.Errorf("unexpected event: %v", e)
+	}
+}
+
+func TestFilterEntries(t *testing.T) {
+	if got := filterEntries(testEntries(), ""); len(got) != 2 {
+		t.Errorf("without name all registries should be returned, got %v", got)
+	}
+	got := filterEntries(testEntries(), "blue")
+	if len(got) != 1 || len(got["default.rg1"]) != 1 || got["default.rg1"][0].Index != 3 {
+		t.Errorf("expected the blue entry only, got %v", got)
+	}
+	if got := filterEntries(testEntries(), "green"); len(got) != 0 {
+		t.Errorf("expected no entries, got %v", got)
+	}
+}
+
+func TestNameSelector(t *testing.T) {
+	defer func() { selector = nil }()
+
+	selector = map[string]string{"name": "blue"}
+	if name, err := nameSelector(); err != nil || name != "blue" {
+		t.Errorf("expected blue, got %s %v", name, err)
+	}
+	selector = map[string]string{"name": "blue", "node": "leaf1"}
+	if _, err := nameSelector(); err == nil {
+		t.Errorf("a selector key other than name should be refused")
+	}
+}
+
+func TestGetIndexRange(t *testing.T) {
+	defer func() { registryName, getIndex = "", -1 }()
+
+	registryName = "rg1"
+	getIndex = math.MaxUint32 + 1
+	err := getCmd.RunE(getCmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("an index above the uint32 range should be refused, got %v", err)
+	}
+}
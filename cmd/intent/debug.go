@@ -0,0 +1,68 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+)
+
+const (
+	// debugPoolsPath is the path of the debug endpoint on the metrics server
+	debugPoolsPath = "/debug/pools"
+	// bearerPrefix precedes the token in the authorization header
+	bearerPrefix = "Bearer "
+)
+
+// newDebugHandler returns the http handler serving the live state of the pools
+// as json. The request must carry the token as bearer token, the optional
+// namespace and name query parameters select the pool of a single registry.
+func newDebugHandler(h handler.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, bearerPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, bearerPrefix)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var crName string
+		if name := req.URL.Query().Get("name"); name != "" {
+			ns := req.URL.Query().Get("namespace")
+			if ns == "" {
+				ns = "default"
+			}
+			crName = ns + "." + name
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(h.Debug(crName)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
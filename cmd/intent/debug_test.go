@@ -0,0 +1,72 @@
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+)
+
+func TestDebugHandler(t *testing.T) {
+	h, err := handler.New(handler.WithLogger(logging.NewNopLogger()))
+	if err != nil {
+		t.Fatalf("cannot create handler: %v", err)
+	}
+	for _, crName := range []string{"default.rg1", "other.rg2"} {
+		if err := h.Init(context.Background(), crName, 16); err != nil {
+			t.Fatalf("cannot init pool: %v", err)
+		}
+	}
+	srv := httptest.NewServer(newDebugHandler(h, "secret"))
+	defer srv.Close()
+
+	get := func(auth, query string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+debugPoolsPath+query, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %v", err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	// the token is only accepted as bearer token
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic secret", "bearer secret", "Bearer"} {
+		resp := get(auth, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("authorization %q: expected unauthorized, got %d", auth, resp.StatusCode)
+		}
+	}
+
+	for query, want := range map[string]int{"": 2, "?name=rg1": 1, "?namespace=other&name=rg1": 0} {
+		resp := get("Bearer secret", query)
+		pools := make([]*handler.PoolDebug, 0)
+		err := json.NewDecoder(resp.Body).Decode(&pools)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("cannot decode the pools: %v", err)
+		}
+		if len(pools) != want {
+			t.Errorf("query %q: expected %d pools, got %d", query, want, len(pools))
+		}
+	}
+
+	resp, err := http.Post(srv.URL+debugPoolsPath, "application/json", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected method not allowed, got %d", resp.StatusCode)
+	}
+}
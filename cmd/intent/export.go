@@ -0,0 +1,138 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"sigs.k8s.io/yaml"
+
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+)
+
+var snapshotFile string
+
+// exportCmd dumps the allocations of the registries of a running server
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the ni allocations",
+	Long:  "export the ni allocations with their index, ni name, registrants and source tags to a json or yaml document, without --registry all registries are exported",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		reply, err := client.ResourceGet(ctx, &resourcepb.Request{
+			Namespace:    clientNamespace,
+			RegistryName: registryName,
+			Request: &resourcepb.Req{
+				Selector: map[string]string{"export": ""},
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "export failed")
+		}
+		snapshots := make([]*handler.PoolSnapshot, 0)
+		if err := json.Unmarshal([]byte(replyString(reply, "snapshots")), &snapshots); err != nil {
+			return errors.Wrap(err, "cannot decode export")
+		}
+
+		// a snapshot is a document, it has no table output
+		if output == outputTable {
+			output = outputJSON
+		}
+		var w io.Writer = os.Stdout
+		if snapshotFile != "" {
+			f, err := os.Create(snapshotFile)
+			if err != nil {
+				return errors.Wrapf(err, "cannot create %s", snapshotFile)
+			}
+			defer f.Close()
+			w = f
+		}
+		return printObject(w, snapshots)
+	},
+}
+
+// importCmd restores the allocations of an export into a running server
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import the ni allocations of an export",
+	Long:  "import the ni allocations of an export with identical indices, the registries must exist with the same size and the import fails on any conflicting allocation",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if snapshotFile == "" {
+			return errors.New("specify the export with --file")
+		}
+		data, err := ioutil.ReadFile(snapshotFile)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read %s", snapshotFile)
+		}
+		// json is valid yaml, so both export formats are accepted
+		data, err = yaml.YAMLToJSON(data)
+		if err != nil {
+			return errors.Wrapf(err, "cannot decode %s", snapshotFile)
+		}
+		snapshots := make([]*handler.PoolSnapshot, 0)
+		if err := json.Unmarshal(data, &snapshots); err != nil {
+			return errors.Wrapf(err, "cannot decode %s", snapshotFile)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		reply, err := client.ResourceRequest(ctx, &resourcepb.Request{
+			Request: &resourcepb.Req{
+				Selector: map[string]string{"import": string(data)},
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "import failed")
+		}
+		fmt.Fprintf(os.Stdout, "imported %s allocations into %d registries\n", replyString(reply, "imported"), len(snapshots))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	addClientFlags(exportCmd)
+	exportCmd.Flags().StringVarP(&snapshotFile, "file", "f", "", "File to write the export to, defaults to stdout.")
+	rootCmd.AddCommand(importCmd)
+	addClientFlags(importCmd)
+	importCmd.Flags().StringVarP(&snapshotFile, "file", "f", "", "File with the export to import.")
+}
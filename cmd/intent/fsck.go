@@ -0,0 +1,123 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+)
+
+var (
+	fsckRepair         bool
+	fsckReleaseOrphans bool
+)
+
+// fsckCmd checks the consistency between the pools and the registers of a running server
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "check the consistency between the pools and the registers",
+	Long:  "check the consistency between the pools and the registers: registrations without register, registers whose index differs from the pool and duplicate index claims. Without --registry all registries are checked.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mode := ""
+		switch {
+		case fsckReleaseOrphans:
+			mode = "release-orphans"
+		case fsckRepair:
+			mode = "repair"
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		// the repairs change the pools, they are requested through the
+		// mutating rpcs
+		req := &resourcepb.Request{
+			Namespace:    clientNamespace,
+			RegistryName: registryName,
+			Request: &resourcepb.Req{
+				Selector: map[string]string{"check": mode},
+			},
+		}
+		var reply *resourcepb.Reply
+		switch mode {
+		case "release-orphans":
+			reply, err = client.ResourceRelease(ctx, req)
+		case "repair":
+			reply, err = client.ResourceRequest(ctx, req)
+		default:
+			reply, err = client.ResourceGet(ctx, req)
+		}
+		if err != nil {
+			return errors.Wrap(err, "check failed")
+		}
+		reports := make([]*handler.CheckReport, 0)
+		if err := json.Unmarshal([]byte(replyString(reply, "reports")), &reports); err != nil {
+			return errors.Wrap(err, "cannot decode check reports")
+		}
+
+		// the orphans are reported, but grpc allocations have no register
+		inconsistencies := 0
+		for _, report := range reports {
+			inconsistencies += report.Inconsistencies()
+		}
+		if output != outputTable {
+			if err := printObject(os.Stdout, reports); err != nil {
+				return err
+			}
+		} else {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "REGISTRY\tKIND\tINDEX\tNI\tREGISTRANT\tREPAIRED\tMESSAGE")
+			for _, report := range reports {
+				for _, f := range report.Findings {
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%t\t%s\n", strings.Join([]string{report.Namespace, report.Name}, "."),
+						f.Kind, f.Index, f.Name, f.Registrant, f.Repaired, f.Message)
+				}
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		if inconsistencies > 0 && mode == "" {
+			return fmt.Errorf("%d inconsistencies found", inconsistencies)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+	addClientFlags(fsckCmd)
+	fsckCmd.Flags().BoolVarP(&fsckRepair, "repair", "", false, "Insert the missing registrations and correct the index recorded by the registers.")
+	fsckCmd.Flags().BoolVarP(&fsckReleaseOrphans, "release-orphans", "", false, "Repair and release the registrations without register, including the grpc allocations.")
+}
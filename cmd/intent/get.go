@@ -0,0 +1,329 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+var (
+	getIndex      int64
+	watchInterval time.Duration
+)
+
+// getCmd gets an allocation by ni name or index
+var getCmd = &cobra.Command{
+	Use:   "get [NI]",
+	Short: "get an ni allocation by name or index",
+	Long:  "get an ni allocation by name, e.g. get --registry nokia-default --selector name=blue or get blue --registry nokia-default, or by index with --index",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if registryName == "" {
+			return errors.New("specify the registry with --registry")
+		}
+		name, err := nameSelector()
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if name != "" && name != args[0] {
+				return fmt.Errorf("the ni %s and the selector name=%s differ", args[0], name)
+			}
+			name = args[0]
+		}
+		if getIndex < 0 && name == "" {
+			return errors.New("specify an ni name, e.g. --selector name=blue, or an --index")
+		}
+		if getIndex > math.MaxUint32 {
+			return fmt.Errorf("index %d out of range, the maximum is %d", getIndex, uint32(math.MaxUint32))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		crName := strings.Join([]string{clientNamespace, registryName}, ".")
+		result := map[string][]*hash.Entry{crName: {}}
+		if getIndex >= 0 {
+			e, err := getEntryByIndex(ctx, client, uint32(getIndex))
+			if err != nil {
+				return err
+			}
+			result[crName] = append(result[crName], e)
+		} else {
+			entries, err := getEntries(ctx, client, "")
+			if err != nil {
+				return err
+			}
+			result[crName] = filterEntries(entries, name)[crName]
+			if len(result[crName]) == 0 {
+				return fmt.Errorf("ni %s not allocated in registry %s", name, crName)
+			}
+		}
+		return printEntries(os.Stdout, result)
+	},
+}
+
+// listCmd lists the allocations of a registry, or of all registries
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the ni allocations",
+	Long:  "list the ni allocations of the registry, without --registry the allocations of all registries are listed, --selector name=blue limits them to an ni",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, err := nameSelector()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		result, err := getEntries(ctx, client, sourceTagSelector)
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, filterEntries(result, name))
+	},
+}
+
+// watchEvent is a change of a registration observed by the watch command
+type watchEvent struct {
+	Type       string     `json:"type"`
+	Registry   string     `json:"registry"`
+	Index      uint32     `json:"index"`
+	Name       string     `json:"name"`
+	Registrant string     `json:"registrant"`
+	SourceTag  labels.Set `json:"source-tag,omitempty"`
+}
+
+// watchCmd polls the allocations and prints the changes
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "watch the ni allocations",
+	Long:  "watch the ni allocations by polling the server, every added or removed registration is printed, a failed poll is retried at the next interval",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, err := nameSelector()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dialCtx, dialCancel := context.WithTimeout(ctx, clientTimeout)
+		client, done, err := resourceClient(dialCtx)
+		dialCancel()
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		if output == outputTable {
+			fmt.Fprintln(tw, "EVENT\tREGISTRY\tINDEX\tNI\tREGISTRANT\tSOURCE-TAG")
+		}
+		known := make(map[string]*watchEvent)
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			reqCtx, reqCancel := context.WithTimeout(ctx, clientTimeout)
+			result, err := getEntries(reqCtx, client, sourceTagSelector)
+			reqCancel()
+			if err != nil {
+				// the server may be restarting, the known registrations are
+				// kept so only the changes are printed once it is back
+				fmt.Fprintf(cmd.ErrOrStderr(), "%v, retrying in %s\n", err, watchInterval)
+				continue
+			}
+
+			current := watchEvents(filterEntries(result, name))
+			changes := make([]*watchEvent, 0)
+			for key, ev := range current {
+				if _, ok := known[key]; !ok {
+					ev.Type = "ADDED"
+					changes = append(changes, ev)
+				}
+			}
+			for key, ev := range known {
+				if _, ok := current[key]; !ok {
+					ev.Type = "REMOVED"
+					changes = append(changes, ev)
+				}
+			}
+			sort.Slice(changes, func(i, j int) bool {
+				if changes[i].Registry != changes[j].Registry {
+					return changes[i].Registry < changes[j].Registry
+				}
+				if changes[i].Index != changes[j].Index {
+					return changes[i].Index < changes[j].Index
+				}
+				return changes[i].Registrant < changes[j].Registrant
+			})
+			for _, ev := range changes {
+				if output != outputTable {
+					if err := printObject(os.Stdout, ev); err != nil {
+						return err
+					}
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", ev.Type, ev.Registry, ev.Index, ev.Name, ev.Registrant, ev.SourceTag.String())
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			known = current
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	addClientFlags(getCmd)
+	getCmd.Flags().Int64VarP(&getIndex, "index", "i", -1, "Index of the ni allocation.")
+	addNameSelectorFlag(getCmd)
+	rootCmd.AddCommand(listCmd)
+	addClientFlags(listCmd)
+	addNameSelectorFlag(listCmd)
+	listCmd.Flags().StringVarP(&sourceTagSelector, "source-tag-selector", "l", "", "Kubernetes label selector matched against the source tags, e.g. node=leaf1")
+	rootCmd.AddCommand(watchCmd)
+	addClientFlags(watchCmd)
+	addNameSelectorFlag(watchCmd)
+	watchCmd.Flags().StringVarP(&sourceTagSelector, "source-tag-selector", "l", "", "Kubernetes label selector matched against the source tags, e.g. node=leaf1")
+	watchCmd.Flags().DurationVarP(&watchInterval, "interval", "", 2*time.Second, "Poll interval of the watch.")
+}
+
+// addNameSelectorFlag adds the selector flag which limits the allocations to
+// an ni name
+func addNameSelectorFlag(cmd *cobra.Command) {
+	cmd.Flags().StringToStringVarP(&selector, "selector", "", nil, "Selector of the ni allocations, e.g. name=blue.")
+}
+
+// nameSelector returns the ni name of the selector flag, name is the only key
+// of the selector
+func nameSelector() (string, error) {
+	for k := range selector {
+		if k != "name" {
+			return "", fmt.Errorf("unsupported selector key %s, e.g. --selector name=blue", k)
+		}
+	}
+	return selector["name"], nil
+}
+
+// filterEntries returns per registry the entries of the ni name, without name
+// all entries are returned
+func filterEntries(result map[string][]*hash.Entry, name string) map[string][]*hash.Entry {
+	if name == "" {
+		return result
+	}
+	filtered := make(map[string][]*hash.Entry, len(result))
+	for crName, entries := range result {
+		for _, e := range entries {
+			if e.Key == name {
+				filtered[crName] = append(filtered[crName], e)
+			}
+		}
+	}
+	return filtered
+}
+
+// getEntries returns per registry the entries matching the source-tag label
+// selector, without registry name the entries of all registries are returned
+func getEntries(ctx context.Context, client resourcepb.ResourceClient, selector string) (map[string][]*hash.Entry, error) {
+	reply, err := client.ResourceGet(ctx, &resourcepb.Request{
+		Namespace:    clientNamespace,
+		RegistryName: registryName,
+		Request: &resourcepb.Req{
+			Selector: map[string]string{"source-tag-selector": selector},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "query failed")
+	}
+	result := make(map[string][]*hash.Entry)
+	if err := json.NewDecoder(strings.NewReader(replyString(reply, "entries"))).Decode(&result); err != nil {
+		return nil, errors.Wrap(err, "cannot decode query result")
+	}
+	return result, nil
+}
+
+// getEntryByIndex returns the entry allocated at the index of the registry
+func getEntryByIndex(ctx context.Context, client resourcepb.ResourceClient, index uint32) (*hash.Entry, error) {
+	reply, err := client.ResourceGet(ctx, &resourcepb.Request{
+		Namespace:    clientNamespace,
+		RegistryName: registryName,
+		Request: &resourcepb.Req{
+			Selector: map[string]string{"index": strconv.Itoa(int(index))},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get failed")
+	}
+	e := &hash.Entry{
+		Index: index,
+		Key:   replyString(reply, "name"),
+	}
+	if err := json.Unmarshal([]byte(replyString(reply, "registrants")), &e.Register); err != nil {
+		return nil, errors.Wrap(err, "cannot decode registrants")
+	}
+	return e, nil
+}
+
+// watchEvents returns the registrations of the entries keyed by registry,
+// index and registrant
+func watchEvents(result map[string][]*hash.Entry) map[string]*watchEvent {
+	events := make(map[string]*watchEvent)
+	for crName, entries := range result {
+		for _, e := range entries {
+			for name, l := range e.Register {
+				events[fmt.Sprintf("%s/%d/%s", crName, e.Index, name)] = &watchEvent{
+					Registry:   crName,
+					Index:      e.Index,
+					Name:       e.Key,
+					Registrant: name,
+					SourceTag:  l,
+				}
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var sourceTagSelector string
+
+// queryCmd queries the allocations of a running server by source-tag label selector
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "query the ni allocations by source-tag label selector",
+	Long:  "query the ni allocations by source-tag label selector, e.g. --source-tag-selector node=leaf1. Without --registry all registries are queried.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+
+		client, done, err := resourceClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer done()
+
+		result, err := getEntries(ctx, client, sourceTagSelector)
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, result)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	addClientFlags(queryCmd)
+	queryCmd.Flags().StringVarP(&sourceTagSelector, "source-tag-selector", "l", "", "Kubernetes label selector matched against the source tags, e.g. node=leaf1,tenant=acme")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+var (
+	simulateFile    string
+	simulateSize    uint32
+	simulateHash    string
+	simulateDetails bool
+)
+
+// simulateCmd simulates the distribution of ni names over a registry
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "simulate the hash distribution of ni names",
+	Long:  "simulate the hash distribution of ni names, read one per line from --file or stdin, over a registry of --size. The indices, collisions, longest probe and load factor are reported per hash function, the registry uses the sum hash function.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if simulateSize == 0 {
+			return errors.New("the size must be larger than 0")
+		}
+		var r io.Reader = os.Stdin
+		if simulateFile != "" && simulateFile != "-" {
+			f, err := os.Open(simulateFile)
+			if err != nil {
+				return errors.Wrapf(err, "cannot open %s", simulateFile)
+			}
+			defer f.Close()
+			r = f
+		}
+		keys, err := readKeys(r)
+		if err != nil {
+			return err
+		}
+
+		names := hash.FuncNames()
+		if simulateHash != "" {
+			if _, ok := hash.Funcs[simulateHash]; !ok {
+				return fmt.Errorf("unknown hash function %s, expected one of %s", simulateHash, strings.Join(names, ", "))
+			}
+			names = []string{simulateHash}
+		}
+		simulations := make([]*hash.Simulation, 0, len(names))
+		for _, name := range names {
+			simulations = append(simulations, hash.Simulate(keys, simulateSize, name, hash.Funcs[name]))
+		}
+
+		if output != outputTable {
+			if !simulateDetails {
+				for _, s := range simulations {
+					s.Placements = nil
+				}
+			}
+			return printObject(os.Stdout, simulations)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		if simulateDetails {
+			for _, s := range simulations {
+				fmt.Fprintln(tw, "FUNC\tNI\tHASH\tINDEX\tPROBE")
+				for _, p := range s.Placements {
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\n", s.Func, p.Key, p.Hash, p.Index, p.Probe)
+				}
+				for _, key := range s.Exhausted {
+					fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\n", s.Func, key)
+				}
+				fmt.Fprintln(tw)
+			}
+		}
+		fmt.Fprintln(tw, "FUNC\tSIZE\tNIS\tLOAD-FACTOR\tCOLLISIONS\tLONGEST-PROBE\tLONGEST-CHAIN\tEXHAUSTED")
+		for _, s := range simulations {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%.3f\t%d\t%d\t%d\t%d\n", s.Func, s.Size, s.Keys, s.LoadFactor,
+				s.Collisions, s.LongestProbe, s.LongestChain, len(s.Exhausted))
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.Flags().StringVarP(&simulateFile, "file", "f", "", "File with one ni name per line, defaults to stdin.")
+	simulateCmd.Flags().Uint32VarP(&simulateSize, "size", "", 0, "Size of the registry.")
+	simulateCmd.Flags().StringVarP(&simulateHash, "hash", "", "", "Hash function to simulate, defaults to all: "+strings.Join(hash.FuncNames(), ", ")+".")
+	simulateCmd.Flags().BoolVarP(&simulateDetails, "details", "", false, "Report the index assigned to every ni name.")
+	simulateCmd.Flags().StringVarP(&output, "output", "o", outputTable, "Output format: table, json or yaml.")
+}
+
+// readKeys returns the non empty lines of the reader, lines starting with #
+// are comments
+func readKeys(r io.Reader) ([]string, error) {
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "cannot read the ni names")
+	}
+	return keys, nil
+}
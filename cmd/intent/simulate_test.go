@@ -0,0 +1,16 @@
+package intent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadKeys(t *testing.T) {
+	keys, err := readKeys(strings.NewReader("# ni names\nblue\n\n  red  \n#green\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "blue" || keys[1] != "red" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
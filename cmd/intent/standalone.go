@@ -0,0 +1,192 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package intent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+	"github.com/yndd/nddr-ni-registry/internal/grpcserver"
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+	"github.com/yndd/nddr-ni-registry/internal/standalone"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+)
+
+var (
+	registryFiles       []string
+	standaloneAddress   string
+	standaloneStorePath string
+	standaloneDefaultNs string
+	standaloneAuditPath string
+)
+
+// standaloneCmd serves the resource grpc api without kubernetes
+var standaloneCmd = &cobra.Command{
+	Use:          "standalone",
+	Short:        "serve the ni-registry grpc api without kubernetes",
+	Long:         "serve the ni-registry grpc api without kubernetes, the registries are loaded from yaml files and the pools are persisted in a local file store",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		zlog := zap.New(zap.UseDevMode(debug), zap.JSONEncoder())
+
+		registries, err := loadRegistries(registryFiles, standaloneDefaultNs)
+		if err != nil {
+			return err
+		}
+		if len(registries) == 0 {
+			return errors.New("no registries found, specify them with --registry-file")
+		}
+
+		// the registries are served from an in-memory client, they are ready
+		// as soon as they are loaded
+		objs := make([]client.Object, 0, len(registries))
+		for _, rg := range registries {
+			if err := rg.InitializeResource(); err != nil {
+				return errors.Wrapf(err, "cannot initialize registry %s/%s", rg.GetNamespace(), rg.GetName())
+			}
+			rg.SetConditions(niv1alpha1.Ready())
+			objs = append(objs, rg)
+		}
+		c, err := standalone.NewClient(scheme, objs...)
+		if err != nil {
+			return errors.Wrap(err, "cannot load the registries")
+		}
+
+		st, err := store.NewFile(standaloneStorePath)
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize the store")
+		}
+
+		auditor, err := newAuditor(auditKind, standaloneAuditPath, auditMaxSize, auditMaxBackups)
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize the audit log")
+		}
+		defer auditor.Close()
+
+		h, err := handler.New(
+			handler.WithLogger(logging.NewLogrLogger(zlog.WithName("handler"))),
+			handler.WithClient(c),
+			handler.WithStore(st),
+			handler.WithAuditor(auditor),
+		)
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize the handler")
+		}
+
+		ctx := ctrl.SetupSignalHandler()
+		for _, rg := range registries {
+			crName := strings.Join([]string{rg.GetNamespace(), rg.GetName()}, ".")
+			if err := h.Init(ctx, crName, rg.GetSize()); err != nil {
+				return err
+			}
+			zlog.Info("registry loaded", "namespace", rg.GetNamespace(), "name", rg.GetName(), "size", rg.GetSize())
+		}
+
+		gs, err := grpcserver.New(
+			grpcserver.WithLogger(logging.NewLogrLogger(zlog.WithName("grpcserver"))),
+			grpcserver.WithClient(c),
+			grpcserver.WithHandler(h),
+			grpcserver.WithConfig(
+				grpcserver.Config{
+					Address:    standaloneAddress,
+					SkipVerify: true,
+					InSecure:   true,
+				},
+			),
+		)
+		if err != nil {
+			return errors.Wrap(err, "unable to initialize grpc server")
+		}
+		if err := gs.Run(ctx); err != nil {
+			return errors.Wrap(err, "unable to start grpc server")
+		}
+
+		zlog.Info("serving standalone", "address", standaloneAddress, "store", standaloneStorePath)
+		<-ctx.Done()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(standaloneCmd)
+	standaloneCmd.Flags().StringSliceVarP(&registryFiles, "registry-file", "f", nil, "YAML file with one or more Registry definitions, can be repeated.")
+	standaloneCmd.Flags().StringVarP(&standaloneAddress, "grpc-server-address", "s", ":"+strconv.Itoa(pkgmetav1.GnmiServerPort), "The address of the grpc server binds to.")
+	standaloneCmd.Flags().StringVarP(&standaloneStorePath, "store-path", "", "./nddr-ni-registry", "The directory of the file store.")
+	standaloneCmd.Flags().StringVarP(&auditKind, "audit", "", audit.KindNone, "The sink of the audit log of the pool mutations: none, stdout, file or rotate.")
+	standaloneCmd.Flags().StringVarP(&standaloneAuditPath, "audit-path", "", "./nddr-ni-registry/audit.log", "The file of the file and rotate audit sinks.")
+	standaloneCmd.Flags().Int64VarP(&auditMaxSize, "audit-max-size", "", 100, "The size in MB from which the rotate audit sink starts a new file.")
+	standaloneCmd.Flags().IntVarP(&auditMaxBackups, "audit-max-backups", "", 10, "The rotated files kept by the rotate audit sink.")
+	standaloneCmd.Flags().StringVarP(&standaloneDefaultNs, "namespace", "n", "default", "Namespace of the registries which do not specify one.")
+}
+
+// loadRegistries returns the Registry definitions of the yaml files, other
+// kinds in the files are skipped
+func loadRegistries(files []string, namespace string) ([]*niv1alpha1.Registry, error) {
+	registries := make([]*niv1alpha1.Registry, 0)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot open %s", file)
+		}
+		rgs, err := decodeRegistries(f, namespace)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot decode %s", file)
+		}
+		registries = append(registries, rgs...)
+	}
+	return registries, nil
+}
+
+func decodeRegistries(r io.Reader, namespace string) ([]*niv1alpha1.Registry, error) {
+	registries := make([]*niv1alpha1.Registry, 0)
+	d := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		rg := &niv1alpha1.Registry{}
+		if err := d.Decode(rg); err != nil {
+			if err == io.EOF {
+				return registries, nil
+			}
+			return nil, err
+		}
+		if rg.Kind != niv1alpha1.RegistryKindKind {
+			continue
+		}
+		if rg.GetNamespace() == "" {
+			rg.SetNamespace(namespace)
+		}
+		if rg.Spec.Registry == nil || rg.GetSize() == 0 {
+			return nil, fmt.Errorf("registry %s/%s has no size", rg.GetNamespace(), rg.GetName())
+		}
+		registries = append(registries, rg)
+	}
+}
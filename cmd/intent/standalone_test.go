@@ -0,0 +1,47 @@
+package intent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeRegistries(t *testing.T) {
+	docs := `
+apiVersion: ni.nddr.yndd.io/v1alpha1
+kind: Registry
+metadata:
+  name: rg1
+spec:
+  registry:
+    size: 100
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm1
+---
+apiVersion: ni.nddr.yndd.io/v1alpha1
+kind: Registry
+metadata:
+  namespace: other
+  name: rg2
+spec:
+  registry:
+    size: 200
+`
+	rgs, err := decodeRegistries(strings.NewReader(docs), "default")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rgs) != 2 {
+		t.Fatalf("expected 2 registries, got %d", len(rgs))
+	}
+	if rgs[0].GetNamespace() != "default" || rgs[1].GetNamespace() != "other" || rgs[1].GetSize() != 200 {
+		t.Errorf("unexpected registries: %s/%s %s/%s", rgs[0].GetNamespace(), rgs[0].GetName(), rgs[1].GetNamespace(), rgs[1].GetName())
+	}
+
+	// a registry without size
+	if _, err := decodeRegistries(strings.NewReader("kind: Registry\nmetadata:\n  name: rg3\n"), "default"); err == nil {
+		t.Errorf("a registry without size should be refused")
+	}
+}
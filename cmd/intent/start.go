@@ -18,6 +18,8 @@ package intent
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -28,20 +30,33 @@ import (
 
 	pkgmetav1 "github.com/yndd/ndd-core/apis/pkg/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
+	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/ndd-runtime/pkg/ratelimiter"
 
+	"github.com/yndd/nddr-ni-registry/internal/audit"
 	"github.com/yndd/nddr-ni-registry/internal/controllers"
 	"github.com/yndd/nddr-ni-registry/internal/grpcserver"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
 	"github.com/yndd/nddr-ni-registry/internal/shared"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	"github.com/yndd/nddr-ni-registry/internal/tracing"
 	//+kubebuilder:scaffold:imports
 )
 
+const (
+	// cacheSyncTimeout bounds the wait for the informer caches of a readiness check
+	cacheSyncTimeout = 1 * time.Second
+	// restoreRetryInterval is the wait before retrying a failed pool restore
+	restoreRetryInterval = 5 * time.Second
+)
+
 var (
 	metricsAddr          string
 	probeAddr            string
@@ -52,6 +67,18 @@ var (
 	podname              string
 	grpcServerAddress    string
 	grpcQueryAddress     string
+	validateOda          bool
+	storeKind            string
+	storePath            string
+	checkInterval        time.Duration
+	debugToken           string
+	otlpEndpoint         string
+	otlpInsecure         bool
+	traceSampleRatio     float64
+	auditKind            string
+	auditPath            string
+	auditMaxSize         int64
+	auditMaxBackups      int
 )
 
 // startCmd represents the start command for the network device driver
@@ -67,6 +94,21 @@ var startCmd = &cobra.Command{
 			// Only use a logr.Logger when debug is on
 			ctrl.SetLogger(zlog)
 		}
+		ctx := ctrl.SetupSignalHandler()
+		shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+			Endpoint:    otlpEndpoint,
+			Insecure:    otlpInsecure,
+			SampleRatio: traceSampleRatio,
+		})
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize tracing")
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				zlog.Error(err, "cannot flush traces")
+			}
+		}()
+
 		zlog.Info("create manager")
 		mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 			Scheme:                 scheme,
@@ -90,19 +132,59 @@ var startCmd = &cobra.Command{
 		}
 		zlog.Info("gnmi address", "address", gnmiAddress)
 
+		st, err := newStore(storeKind, storePath, mgr.GetClient())
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize the store")
+		}
+		zlog.Info("store", "kind", storeKind)
+
+		auditor, err := newAuditor(auditKind, auditPath, auditMaxSize, auditMaxBackups)
+		if err != nil {
+			return errors.Wrap(err, "cannot initialize the audit log")
+		}
+		defer auditor.Close()
+		zlog.Info("audit", "kind", auditKind)
+
 		handler, err := handler.New(
 			handler.WithLogger(logging.NewLogrLogger(zlog.WithName("handler"))),
 			handler.WithClient(mgr.GetClient()),
+			handler.WithStore(st),
+			handler.WithAuditor(auditor),
+			handler.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor("nddo/handler"))),
 		)
 		if err != nil {
 			return errors.Wrap(err, "cannot initialize the handler")
 		}
 
+		// the pools are restored on every replica, also without leadership
+		if err := mgr.Add(&poolRestorer{
+			handler: handler,
+			log:     logging.NewLogrLogger(zlog.WithName("restore")),
+		}); err != nil {
+			return errors.Wrap(err, "cannot add the pool restore")
+		}
+
+		if checkInterval > 0 {
+			checkLog := logging.NewLogrLogger(zlog.WithName("check"))
+			if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+				return runChecks(ctx, handler, checkInterval, checkLog)
+			})); err != nil {
+				return errors.Wrap(err, "cannot add the consistency check")
+			}
+		}
+
+		if debugToken != "" {
+			if err := mgr.AddMetricsExtraHandler(debugPoolsPath, newDebugHandler(handler, debugToken)); err != nil {
+				return errors.Wrap(err, "cannot add the debug endpoint")
+			}
+		}
+
 		nddcopts := &shared.NddControllerOptions{
-			Logger:    logging.NewLogrLogger(zlog.WithName("ni-registry")),
-			Poll:      pollInterval,
-			Namespace: namespace,
-			Handler:   handler,
+			Logger:      logging.NewLogrLogger(zlog.WithName("ni-registry")),
+			Poll:        pollInterval,
+			Namespace:   namespace,
+			Handler:     handler,
+			ValidateOda: validateOda,
 		}
 
 		// initialize controllers
@@ -137,12 +219,25 @@ var startCmd = &cobra.Command{
 		if err := mgr.AddHealthzCheck("health", healthz.Ping); err != nil {
 			return errors.Wrap(err, "unable to set up health check")
 		}
-		if err := mgr.AddReadyzCheck("check", healthz.Ping); err != nil {
+		if err := mgr.AddReadyzCheck("grpc", gs.Ready); err != nil {
+			return errors.Wrap(err, "unable to set up ready check")
+		}
+		if err := mgr.AddReadyzCheck("cache", func(req *http.Request) error {
+			ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+			defer cancel()
+			if !mgr.GetCache().WaitForCacheSync(ctx) {
+				return errors.New("informer caches not synced")
+			}
+			return nil
+		}); err != nil {
+			return errors.Wrap(err, "unable to set up ready check")
+		}
+		if err := mgr.AddReadyzCheck("pools", handler.Ready); err != nil {
 			return errors.Wrap(err, "unable to set up ready check")
 		}
 
 		zlog.Info("starting manager")
-		if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		if err := mgr.Start(ctx); err != nil {
 			return errors.Wrap(err, "problem running manager")
 		}
 		return nil
@@ -161,6 +256,107 @@ func init() {
 	startCmd.Flags().StringVarP(&podname, "podname", "", os.Getenv("POD_NAME"), "Name from the pod")
 	startCmd.Flags().StringVarP(&grpcServerAddress, "grpc-server-address", "s", "", "The address of the grpc server binds to.")
 	startCmd.Flags().StringVarP(&grpcQueryAddress, "grpc-query-address", "", "", "Validation query address.")
+	startCmd.Flags().BoolVarP(&validateOda, "validate-oda", "", false, "Validate the organization, deployment and availability zone of a registry against the org registry, kinds the org registry does not serve are not validated.")
+	startCmd.Flags().StringVarP(&storeKind, "store", "", store.KindMemory, "The store persisting the pools: memory, configmap or file.")
+	startCmd.Flags().StringVarP(&storePath, "store-path", "", "/var/lib/nddr-ni-registry", "The directory of the file store.")
+	startCmd.Flags().DurationVarP(&checkInterval, "check-interval", "", 0, "Interval of the consistency check between the pools and the registers, 0 disables the check.")
+	startCmd.Flags().StringVarP(&debugToken, "debug-token", "", os.Getenv("DEBUG_TOKEN"), "Bearer token of the "+debugPoolsPath+" endpoint on the metrics server exposing the live pool state, empty disables the endpoint.")
+	startCmd.Flags().StringVarP(&otlpEndpoint, "otlp-endpoint", "", "", "The host:port of the OTLP grpc collector the traces are exported to, empty disables the export.")
+	startCmd.Flags().BoolVarP(&otlpInsecure, "otlp-insecure", "", false, "Connect to the OTLP collector without TLS.")
+	startCmd.Flags().StringVarP(&auditKind, "audit", "", audit.KindNone, "The sink of the audit log of the pool mutations: none, stdout, file or rotate.")
+	startCmd.Flags().StringVarP(&auditPath, "audit-path", "", "/var/log/nddr-ni-registry/audit.log", "The file of the file and rotate audit sinks.")
+	startCmd.Flags().Int64VarP(&auditMaxSize, "audit-max-size", "", 100, "The size in MB from which the rotate audit sink starts a new file.")
+	startCmd.Flags().IntVarP(&auditMaxBackups, "audit-max-backups", "", 10, "The rotated files kept by the rotate audit sink.")
+	startCmd.Flags().Float64VarP(&traceSampleRatio, "trace-sample-ratio", "", 1, "The fraction of the traces which are sampled, a sampled parent span is always continued.")
+}
+
+// runChecks checks the consistency of all pools every interval until the
+// context is done, the inconsistencies are reported and not repaired
+func runChecks(ctx context.Context, h handler.Handler, interval time.Duration, log logging.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reports, err := h.Check(ctx, "", handler.CheckOptions{})
+			if err != nil {
+				log.Info("consistency check failed", "error", err)
+				continue
+			}
+			for _, report := range reports {
+				for _, f := range report.Findings {
+					if f.Kind == handler.FindingOrphan {
+						// every grpc allocation is an orphan
+						log.Debug("orphan registration", "namespace", report.Namespace, "registry", report.Name,
+							"index", f.Index, "ni", f.Name, "registrant", f.Registrant)
+						continue
+					}
+					log.Info("inconsistency", "namespace", report.Namespace, "registry", report.Name,
+						"kind", f.Kind, "index", f.Index, "ni", f.Name, "registrant", f.Registrant, "message", f.Message)
+				}
+			}
+		}
+	}
+}
+
+// poolRestorer restores the pools from the store once the caches are synced
+type poolRestorer struct {
+	handler handler.Handler
+	log     logging.Logger
+}
+
+// Start restores the pools, a failed restore is retried until the context is done
+func (p *poolRestorer) Start(ctx context.Context) error {
+	for {
+		err := p.handler.Restore(ctx)
+		if err == nil {
+			return nil
+		}
+		p.log.Info("pool restore failed", "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(restoreRetryInterval):
+		}
+	}
+}
+
+// NeedLeaderElection is false, so a replica without leadership serves the
+// grpc api with the persisted pools
+func (p *poolRestorer) NeedLeaderElection() bool {
+	return false
+}
+
+// newStore returns the store persisting the pools
+func newStore(kind, path string, c client.Client) (store.Store, error) {
+	switch kind {
+	case store.KindMemory:
+		return store.NewMemory(), nil
+	case store.KindConfigMap:
+		return store.NewConfigMap(c), nil
+	case store.KindFile:
+		return store.NewFile(path)
+	default:
+		return nil, fmt.Errorf("unknown store %s, expected memory, configmap or file", kind)
+	}
+}
+
+// newAuditor returns the auditor recording the pool mutations
+func newAuditor(kind, path string, maxSize int64, maxBackups int) (audit.Auditor, error) {
+	switch kind {
+	case audit.KindNone:
+		return audit.NewNop(), nil
+	case audit.KindStdout:
+		return audit.NewWriter(os.Stdout), nil
+	case audit.KindFile:
+		return audit.NewFile(path)
+	case audit.KindRotate:
+		return audit.NewRotating(path, maxSize*1024*1024, maxBackups)
+	default:
+		return nil, fmt.Errorf("unknown audit sink %s, expected none, stdout, file or rotate", kind)
+	}
 }
 
 func nddCtlrOptions(c int) controller.Options {
@@ -10,9 +10,15 @@ require (
 	github.com/yndd/nddo-grpc v0.0.16
 	github.com/yndd/nddo-runtime v0.0.53
 	github.com/yndd/nddr-org-registry v0.0.8
+	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.27.0
+	go.opentelemetry.io/otel v1.2.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc v1.2.0
+	go.opentelemetry.io/otel/sdk v1.2.0
+	go.opentelemetry.io/otel/trace v1.2.0
 	google.golang.org/grpc v1.42.0
 	k8s.io/api v0.22.2
 	k8s.io/apimachinery v0.22.2
 	k8s.io/client-go v0.22.2
 	sigs.k8s.io/controller-runtime v0.9.3
+	sigs.k8s.io/yaml v1.3.0
 )
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of audit sinks
+const (
+	KindNone   = "none"
+	KindStdout = "stdout"
+	KindFile   = "file"
+	KindRotate = "rotate"
+)
+
+// Actions on the pool
+const (
+	ActionAllocate = "allocate"
+	// ActionUpdate is an allocation of a registrant which changes its source tag
+	ActionUpdate  = "update"
+	ActionRelease = "release"
+	ActionImport  = "import"
+)
+
+// Paths through which a pool mutation is requested
+const (
+	// PathRegister is the reconcile of a Register CR
+	PathRegister = "register"
+	// PathGrpc is a request on the grpc api
+	PathGrpc = "grpc"
+	// PathRegistry is the deletion of a registry with the cascade policy
+	PathRegistry = "registry"
+	// PathCheck is the repair of a consistency check
+	PathCheck = "check"
+	// PathUnknown is a mutation without origin in its context
+	PathUnknown = "unknown"
+)
+
+// Entry is an audit record of a mutation of the pool of a registry
+type Entry struct {
+	Time       time.Time         `json:"time"`
+	Action     string            `json:"action"`
+	Namespace  string            `json:"namespace"`
+	Registry   string            `json:"registry"`
+	Name       string            `json:"name"`
+	Index      uint32            `json:"index"`
+	Registrant string            `json:"registrant"`
+	SourceTag  map[string]string `json:"source-tag,omitempty"`
+	Path       string            `json:"path"`
+	// Peer is the address of the grpc client
+	Peer string `json:"peer,omitempty"`
+}
+
+// Auditor records the audit entries, an auditor is safe for concurrent use
+// and separate from the debug logger
+type Auditor interface {
+	// Record appends the entry, an entry without time gets the current time
+	Record(e *Entry) error
+	// Close flushes and closes the sink
+	Close() error
+}
+
+// Origin is the path through which a pool mutation is requested
+type Origin struct {
+	Path string
+	Peer string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context carrying the origin of the pool mutations
+// requested with it
+func WithOrigin(ctx context.Context, o Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// OriginFrom returns the origin carried by the context, the path is
+// PathUnknown when the context carries no origin
+func OriginFrom(ctx context.Context) Origin {
+	if o, ok := ctx.Value(originKey{}).(Origin); ok {
+		return o
+	}
+	return Origin{Path: PathUnknown}
+}
+
+type nop struct{}
+
+// NewNop returns an auditor discarding the entries
+func NewNop() Auditor {
+	return nop{}
+}
+
+func (nop) Record(*Entry) error { return nil }
+
+func (nop) Close() error { return nil }
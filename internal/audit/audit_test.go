@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTime gives the entries a fixed length
+var testTime = time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// readEntries returns the entries of the json lines of the file, a missing
+// file has no entries
+func readEntries(t *testing.T, path string) []*Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("cannot open %s: %v", path, err)
+	}
+	defer f.Close()
+	entries := make([]*Entry, 0)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		e := &Entry{}
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			t.Fatalf("invalid json line %q: %v", s.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestRotating(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	b, err := marshal(&Entry{Action: ActionAllocate, Name: "ni0", Time: testTime})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// two entries fit in a file
+	a, err := NewRotating(path, int64(2*len(b)+1), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"ni0", "ni1", "ni2", "ni3", "ni4", "ni5", "ni6"} {
+		if err := a.Record(&Entry{Action: ActionAllocate, Name: name, Time: testTime}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the oldest file is dropped
+	for file, names := range map[string][]string{
+		path:        {"ni6"},
+		path + ".1": {"ni4", "ni5"},
+		path + ".2": {"ni2", "ni3"},
+		path + ".3": nil,
+	} {
+		entries := readEntries(t, file)
+		if len(entries) != len(names) {
+			t.Errorf("%s: expected %v, got %d entries", file, names, len(entries))
+			continue
+		}
+		for i, e := range entries {
+			if e.Name != names[i] {
+				t.Errorf("%s: expected %s, got %s", file, names[i], e.Name)
+			}
+		}
+	}
+
+	// a restart continues at the size of the file
+	a, err = NewRotating(path, int64(2*len(b)+1), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := a.Record(&Entry{Action: ActionAllocate, Name: "ni7", Time: testTime}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.Close()
+	if entries := readEntries(t, path); len(entries) != 2 {
+		t.Errorf("the entry should be appended, got %d entries", len(entries))
+	}
+	if _, err := NewRotating(path, 0, 2); err == nil {
+		t.Errorf("a size of 0 should be refused")
+	}
+}
+
+func TestRotatingWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewRotating(path, 1, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"ni0", "ni1"} {
+		if err := a.Record(&Entry{Name: name}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	a.Close()
+	entries := readEntries(t, path)
+	if len(entries) != 1 || entries[0].Name != "ni1" {
+		t.Errorf("only the last entry should be kept: %v", entries)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("no backup should be kept")
+	}
+}
+
+func TestRotatingRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewRotating(path, 1, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	if err := a.Record(&Entry{Name: "ni0"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the backup is a directory, the rename fails
+	if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0700); err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	if err := a.Record(&Entry{Name: "ni1"}); err == nil {
+		t.Errorf("the failed rotation should be reported")
+	}
+	if err := a.Record(&Entry{Name: "ni2"}); err == nil {
+		t.Errorf("the rotation should be retried and fail again")
+	}
+	if entries := readEntries(t, path); len(entries) != 3 {
+		t.Errorf("the entries should be appended to the current file, got %d", len(entries))
+	}
+
+	// the rotation succeeds once the backup can be written
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("cannot remove directory: %v", err)
+	}
+	if err := a.Record(&Entry{Name: "ni3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := readEntries(t, path); len(entries) != 1 || entries[0].Name != "ni3" {
+		t.Errorf("expected a new file with the last entry: %v", entries)
+	}
+	if entries := readEntries(t, path+".1"); len(entries) != 3 {
+		t.Errorf("expected the backup with the earlier entries, got %d", len(entries))
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	if o := OriginFrom(context.Background()); o.Path != PathUnknown {
+		t.Errorf("expected the unknown path, got %s", o.Path)
+	}
+	ctx := WithOrigin(context.Background(), Origin{Path: PathGrpc, Peer: "10.0.0.1:1234"})
+	if o := OriginFrom(ctx); o.Path != PathGrpc || o.Peer != "10.0.0.1:1234" {
+		t.Errorf("unexpected origin: %v", o)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// errors
+	errRotateAuditLog = "cannot rotate audit log"
+)
+
+// rotating appends the entries to a file which is rotated once it exceeds
+// maxSize, the rotated files are kept as <path>.1 up to <path>.<maxBackups>
+// with <path>.1 the most recent
+type rotating struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mutex sync.Mutex
+	f     *os.File
+	size  int64
+}
+
+// NewRotating returns an auditor appending one json line per entry to the
+// file at path, which is rotated when it exceeds maxSize bytes
+func NewRotating(path string, maxSize int64, maxBackups int) (Auditor, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid audit log size %d", maxSize)
+	}
+	a := &rotating{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *rotating) Record(e *Entry) error {
+	b, err := marshal(e)
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.f == nil {
+		// the file could not be opened again after a failed rotation
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	var rerr error
+	if a.size > 0 && a.size+int64(len(b)) > a.maxSize {
+		// a failed rotation continues on the current file, the rotation is
+		// retried with the next entry
+		if rerr = a.rotate(); a.f == nil {
+			return rerr
+		}
+	}
+	n, err := a.f.Write(b)
+	a.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, errWriteAuditLog)
+	}
+	return rerr
+}
+
+func (a *rotating) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	return a.f.Close()
+}
+
+// open opens the file at path and continues at its current size
+func (a *rotating) open() error {
+	f, err := openAppend(a.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, errOpenAuditLog)
+	}
+	a.f = f
+	a.size = fi.Size()
+	return nil
+}
+
+// rotate shifts the backups, drops the oldest and starts a new file. When the
+// backups cannot be shifted the current file is opened again, the caller holds
+// the mutex.
+func (a *rotating) rotate() error {
+	err := a.f.Close()
+	a.f = nil
+	if err == nil {
+		err = a.shift()
+	}
+	if oerr := a.open(); oerr != nil {
+		return errors.Wrap(oerr, errRotateAuditLog)
+	}
+	if err != nil {
+		return errors.Wrap(err, errRotateAuditLog)
+	}
+	return nil
+}
+
+// shift renames the file to <path>.1 and the backups to the next number, the
+// oldest backup is dropped
+func (a *rotating) shift() error {
+	if a.maxBackups <= 0 {
+		return os.Remove(a.path)
+	}
+	for i := a.maxBackups - 1; i > 0; i-- {
+		src := fmt.Sprintf("%s.%d", a.path, i)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", a.path, i+1)); err != nil {
+			return err
+		}
+	}
+	return os.Rename(a.path, a.path+".1")
+}
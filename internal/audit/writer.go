@@ -0,0 +1,100 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// errors
+	errOpenAuditLog  = "cannot open audit log"
+	errWriteAuditLog = "cannot write audit log"
+)
+
+// writer appends the entries as json lines to a writer
+type writer struct {
+	mutex sync.Mutex
+	w     io.Writer
+	c     io.Closer
+}
+
+// NewWriter returns an auditor writing one json line per entry to w, e.g.
+// os.Stdout, the writer is not closed by the auditor
+func NewWriter(w io.Writer) Auditor {
+	return &writer{w: w}
+}
+
+// NewFile returns an auditor appending one json line per entry to the file at
+// path, the file is created when it does not exist
+func NewFile(path string) (Auditor, error) {
+	f, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{w: f, c: f}, nil
+}
+
+func (a *writer) Record(e *Entry) error {
+	b, err := marshal(e)
+	if err != nil {
+		return err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, err := a.w.Write(b); err != nil {
+		return errors.Wrap(err, errWriteAuditLog)
+	}
+	return nil
+}
+
+func (a *writer) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.c == nil {
+		return nil
+	}
+	return a.c.Close()
+}
+
+// marshal returns the json line of the entry
+func marshal(e *Entry) ([]byte, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrap(err, errWriteAuditLog)
+	}
+	return append(b, '\n'), nil
+}
+
+// openAppend opens the file at path for appending, the audit log is only
+// readable by its owner
+func openAppend(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, errOpenAuditLog)
+	}
+	return f, nil
+}
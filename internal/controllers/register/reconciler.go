@@ -18,6 +18,7 @@ package register
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -27,20 +28,22 @@ import (
 	"github.com/yndd/nddo-runtime/pkg/reconciler/managed"
 	"github.com/yndd/nddo-runtime/pkg/resource"
 	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
 	"github.com/yndd/nddr-ni-registry/internal/shared"
-	"github.com/yndd/nddr-org-registry/pkg/registry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 const (
-	// timers
-	reconcileTimeout = 1 * time.Minute
-	veryShortWait    = 1 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
+	errIndexRegister      = "cannot index the registers by registry"
+	// infoPoll is the info key which requeues the register after the poll interval
+	infoPoll = "poll"
 )
 
 // Setup adds a controller that reconciles infra.
@@ -49,9 +52,9 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 	rgfn := func() niv1alpha1.Rg { return &niv1alpha1.Registry{} }
 	//rglfn := func() niv1alpha1.RgList { return &niv1alpha1.RegistryList{} }
 	//rrfn := func() niv1alpha1.Rr { return &niv1alpha1.Register{} }
-	//rrlfn := func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} }
+	rrlfn := func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} }
 
-	//speedy := make(map[string]int)
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
 
 	r := managed.NewReconciler(mgr,
 		resource.ManagedKind(niv1alpha1.RegisterGroupVersionKind),
@@ -65,21 +68,34 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 			newRegistry: rgfn,
 			//newRegistryList: rglfn,
 			//pool:    nddcopts.Pool,
-			handler: nddcopts.Handler,
-			//speedy:           speedy,
-			registry: nddcopts.Registry,
+			handler:      nddcopts.Handler,
+			pollInterval: nddcopts.Poll,
+			record:       recorder,
 		}),
-		//managed.WithSpeedy(speedy),
-		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		managed.WithRecorder(recorder),
 	)
 
+	// index the registers by the registry they target, so a registry event only
+	// enqueues its own registers
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &niv1alpha1.Register{}, registryIndexKey, registryIndexValue); err != nil {
+		return errors.Wrap(err, errIndexRegister)
+	}
+
+	registryHandler := &EnqueueRequestForRegistryRegisters{
+		client:          mgr.GetClient(),
+		log:             nddcopts.Logger,
+		ctx:             context.Background(),
+		newRegisterList: rrlfn,
+	}
+
+	// the generation predicate is scoped to the registers, the registry watch
+	// needs the status updates to detect the ready transition
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o).
-		For(&niv1alpha1.Register{}).
-		Owns(&niv1alpha1.Register{}).
-		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
-		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
+		For(&niv1alpha1.Register{}, builder.WithPredicates(resource.IgnoreUpdateWithoutGenerationChangePredicate())).
+		Owns(&niv1alpha1.Register{}, builder.WithPredicates(resource.IgnoreUpdateWithoutGenerationChangePredicate())).
+		Watches(&source.Kind{Type: &niv1alpha1.Registry{}}, registryHandler).
 		Complete(r)
 
 }
@@ -91,16 +107,25 @@ type application struct {
 	newRegistry func() niv1alpha1.Rg
 
 	//pool    map[string]hash.HashTable
-	handler handler.Handler
-	//speedy   map[string]int
-	registry registry.Registry
+	handler      handler.Handler
+	pollInterval time.Duration
+	// record emits the allocation events on the register
+	record event.Recorder
 
 	//poolmutex sync.Mutex
-	//speedyMutex sync.Mutex
 }
 
-func getCrName(cr niv1alpha1.Rr) string {
-	return strings.Join([]string{cr.GetNamespace(), cr.GetRegistryName()}, ".")
+func getCrName(cr niv1alpha1.Rr, registryName string) string {
+	return strings.Join([]string{cr.GetRegistryNamespace(), registryName}, ".")
+}
+
+// getRegistryName returns the registry the register targets, a registry selected
+// by oda is resolved by the handler
+func (r *application) getRegistryName(ctx context.Context, cr niv1alpha1.Rr) (string, error) {
+	if registryName := cr.GetRegistryName(); registryName != "" || !cr.HasOda() {
+		return registryName, nil
+	}
+	return r.handler.ResolveRegistry(ctx, cr.GetRegistryNamespace(), cr.GetOrganization(), cr.GetDeployment(), cr.GetAvailabilityZone())
 }
 
 func (r *application) Initialize(ctx context.Context, mg resource.Managed) error {
@@ -123,19 +148,7 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	/*
-		cr, _ := mg.(*niv1alpha1.Registry)
-		crName := getCrName(cr)
-		r.speedyMutex.Lock()
-		speedy := r.speedy[crName]
-		r.speedyMutex.Unlock()
-		if speedy <= 5 {
-			r.log.Debug("Speedy", "number", speedy)
-			speedy++
-			return veryShortWait
-		}
-	*/
-	return reconcileTimeout
+	return r.pollInterval
 }
 
 func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, error) {
@@ -146,22 +159,35 @@ func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, er
 	log := r.log.WithValues("function", "handleAppLogic", "crname", cr.GetName())
 	log.Debug("handleDelete")
 
-	crName := getCrName(cr)
+	// release from the registry the register was allocated from
+	registryName := cr.GetStatusRegistryName()
+	if registryName == "" {
+		var err error
+		if registryName, err = r.getRegistryName(ctx, cr); err != nil {
+			return true, err
+		}
+	}
 
 	registerInfo := &handler.RegisterInfo{
-		Namespace:    cr.GetNamespace(),
-		RegistryName: cr.GetRegistryName(),
-		CrName:       crName,
-		Name:         cr.GetName(),
-		Selector:     cr.GetSelector(),
-		SourceTag:    cr.GetSourceTag(),
+		Namespace:          cr.GetRegistryNamespace(),
+		RequesterNamespace: cr.GetNamespace(),
+		RegistryName:       registryName,
+		CrName:             getCrName(cr, registryName),
+		Name:               cr.GetName(),
+		Selector:           cr.GetSelector(),
+		SourceTag:          cr.GetSourceTag(),
 	}
 
 	log.Debug("resource dealloc", "registerInfo", registerInfo)
 
+	ctx = audit.WithOrigin(ctx, audit.Origin{Path: audit.PathRegister})
 	if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
 		return true, err
 	}
+	if index, ok := cr.HasNi(); ok {
+		r.record.Event(cr, event.Normal(handler.ReasonReleased,
+			fmt.Sprintf("index %d released in registry %s/%s", index, cr.GetRegistryNamespace(), registryName)))
+	}
 
 	return true, nil
 }
@@ -174,28 +200,47 @@ func (r *application) handleAppLogic(ctx context.Context, cr niv1alpha1.Rr) (map
 	log := r.log.WithValues("function", "handleAppLogic", "crname", cr.GetName())
 	log.Debug("handleAppLogic")
 
+	registryName, err := r.getRegistryName(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+
 	registerInfo := &handler.RegisterInfo{
-		Namespace:    cr.GetNamespace(),
-		RegistryName: cr.GetRegistryName(),
-		Name:         cr.GetName(),
-		CrName:       getCrName(cr),
-		Selector:     cr.GetSelector(),
-		SourceTag:    cr.GetSourceTag(),
+		Namespace:          cr.GetRegistryNamespace(),
+		RequesterNamespace: cr.GetNamespace(),
+		RegistryName:       registryName,
+		Name:               cr.GetName(),
+		CrName:             getCrName(cr, registryName),
+		Selector:           cr.GetSelector(),
+		SourceTag:          cr.GetSourceTag(),
 	}
 
 	log.Debug("resource alloc", "registerInfo", registerInfo)
 
+	prev, allocated := cr.HasNi()
+	ctx = audit.WithOrigin(ctx, audit.Origin{Path: audit.PathRegister})
 	index, err := r.handler.Register(ctx, registerInfo)
 	if err != nil {
+		switch errors.Cause(err) {
+		case handler.ErrPoolExhausted:
+			r.record.Event(cr, event.Warning(handler.ReasonExhausted, err))
+		case handler.ErrInvalidSelector:
+			r.record.Event(cr, event.Warning(handler.ReasonSelector, err))
+		}
 		return nil, err
 	}
+	if !allocated || prev != *index {
+		r.record.Event(cr, event.Normal(handler.ReasonAllocated,
+			fmt.Sprintf("index %d allocated in registry %s/%s", *index, cr.GetRegistryNamespace(), registryName)))
+	}
 
 	cr.SetNi(*index)
 
 	cr.SetOrganization(cr.GetOrganization())
 	cr.SetDeployment(cr.GetDeployment())
 	cr.SetAvailabilityZone(cr.GetAvailabilityZone())
-	cr.SetRegistryName(cr.GetRegistryName())
+	cr.SetRegistryName(registryName)
 
-	return nil, nil
+	// the managed reconciler only consults Timeout for a non-empty info map
+	return map[string]string{infoPoll: r.pollInterval.String()}, nil
 }
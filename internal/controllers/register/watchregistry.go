@@ -0,0 +1,132 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package register
+
+import (
+	"context"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// registryIndexKey indexes the registers by <namespace>/<name> of the registry they target
+	registryIndexKey = "registry"
+)
+
+type adder interface {
+	Add(item interface{})
+}
+
+// registryIndexValue returns the value of the registry index of a register, a
+// register selecting its registry by oda is indexed by the registry it was
+// resolved to, or with an empty name when it was not resolved yet
+func registryIndexValue(o client.Object) []string {
+	rr, ok := o.(niv1alpha1.Rr)
+	if !ok {
+		return nil
+	}
+	registryName := rr.GetRegistryName()
+	if registryName == "" {
+		if !rr.HasOda() {
+			return nil
+		}
+		registryName = rr.GetStatusRegistryName()
+	}
+	return []string{rr.GetRegistryNamespace() + "/" + registryName}
+}
+
+type EnqueueRequestForRegistryRegisters struct {
+	client client.Client
+	log    logging.Logger
+	ctx    context.Context
+
+	newRegisterList func() niv1alpha1.RrList
+}
+
+// Create enqueues a request for all registers of the registry if it is created ready.
+func (e *EnqueueRequestForRegistryRegisters) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	if isReady(evt.Object) {
+		e.add(evt.Object, q)
+	}
+}
+
+// Update enqueues a request for all registers of the registry when it becomes ready or is resized.
+func (e *EnqueueRequestForRegistryRegisters) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	becameReady := !isReady(evt.ObjectOld) && isReady(evt.ObjectNew)
+	if becameReady || getSize(evt.ObjectOld) != getSize(evt.ObjectNew) {
+		e.add(evt.ObjectNew, q)
+	}
+}
+
+// Delete does not enqueue, registers of a deleted registry cannot be allocated.
+func (e *EnqueueRequestForRegistryRegisters) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+}
+
+// Generic enqueues a request for all registers of the registry.
+func (e *EnqueueRequestForRegistryRegisters) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+func (e *EnqueueRequestForRegistryRegisters) add(obj client.Object, queue adder) {
+	rg, ok := obj.(*niv1alpha1.Registry)
+	if !ok {
+		return
+	}
+	log := e.log.WithValues("function", "watch registry", "name", rg.GetName(), "namespace", rg.GetNamespace())
+	log.Debug("registry handleEvent")
+
+	// the registers targeting the registry and the oda registers which are not resolved yet
+	for _, registryName := range []string{rg.GetName(), ""} {
+		d := e.newRegisterList()
+		if err := e.client.List(e.ctx, d, client.MatchingFields{
+			registryIndexKey: rg.GetNamespace() + "/" + registryName,
+		}); err != nil {
+			log.Debug("cannot list registers", "error", err)
+			return
+		}
+
+		for _, register := range d.GetRegisters() {
+			log.Debug("watch registry event", "register", register.GetName())
+			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: register.GetNamespace(),
+				Name:      register.GetName()}})
+		}
+	}
+}
+
+func isReady(obj client.Object) bool {
+	rg, ok := obj.(niv1alpha1.Rg)
+	if !ok {
+		return false
+	}
+	return rg.GetCondition(niv1alpha1.ConditionKindReady).Status == corev1.ConditionTrue
+}
+
+func getSize(obj client.Object) uint32 {
+	rg, ok := obj.(*niv1alpha1.Registry)
+	if !ok || rg.Spec.Registry == nil {
+		return 0
+	}
+	return rg.GetSize()
+}
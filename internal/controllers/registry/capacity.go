@@ -0,0 +1,100 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	nddv1 "github.com/yndd/ndd-runtime/apis/common/v1"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// event reasons
+	reasonCapacityWarning   event.Reason = "CapacityWarning"
+	reasonCapacityRecovered event.Reason = "CapacityRecovered"
+	reasonExhausted         event.Reason = "Exhausted"
+	reasonNotExhausted      event.Reason = "ExhaustionRecovered"
+)
+
+// capacityThreshold is a threshold on the allocated percentage of the pool
+// with the condition reflecting it
+type capacityThreshold struct {
+	kind        nddv1.ConditionKind
+	threshold   uint32
+	set         func(string) nddv1.Condition
+	clear       func(string) nddv1.Condition
+	reasonSet   event.Reason
+	reasonClear event.Reason
+}
+
+// handleCapacity sets the CapacityWarning and Exhausted conditions of the
+// registry. A condition is set once the allocated percentage of the pool
+// reaches its threshold and is only cleared when the allocations drop the
+// hysteresis below the threshold, so a pool around a threshold does not flap.
+func (r *application) handleCapacity(cr niv1alpha1.Rg, allocated uint32) {
+	size := cr.GetSize()
+	if size == 0 {
+		return
+	}
+	usage := uint32(uint64(allocated) * 100 / uint64(size))
+
+	for _, t := range []capacityThreshold{
+		{
+			kind:        niv1alpha1.ConditionKindCapacityWarning,
+			threshold:   cr.GetCapacityWarning(),
+			set:         niv1alpha1.CapacityWarning,
+			clear:       niv1alpha1.CapacityOK,
+			reasonSet:   reasonCapacityWarning,
+			reasonClear: reasonCapacityRecovered,
+		},
+		{
+			kind:        niv1alpha1.ConditionKindExhausted,
+			threshold:   cr.GetCapacityCritical(),
+			set:         niv1alpha1.Exhausted,
+			clear:       niv1alpha1.NotExhausted,
+			reasonSet:   reasonExhausted,
+			reasonClear: reasonNotExhausted,
+		},
+	} {
+		msg := fmt.Sprintf("%d of %d network-instances allocated (%d%%), threshold %d%%", allocated, size, usage, t.threshold)
+		status := cr.GetCondition(t.kind).Status
+		switch {
+		case t.threshold > 0 && usage >= t.threshold:
+			if status != corev1.ConditionTrue {
+				cr.SetConditions(t.set(msg))
+				r.record.Event(cr, event.Warning(t.reasonSet, errors.New(msg)))
+			}
+		case t.threshold == 0 || usage+cr.GetCapacityHysteresis() < t.threshold:
+			if status == corev1.ConditionTrue {
+				r.record.Event(cr, event.Normal(t.reasonClear, msg))
+			}
+			if status != corev1.ConditionFalse {
+				cr.SetConditions(t.clear(msg))
+			}
+		default:
+			// within the hysteresis the condition is kept, an unknown condition
+			// is initialized as cleared
+			if status != corev1.ConditionTrue && status != corev1.ConditionFalse {
+				cr.SetConditions(t.clear(msg))
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// maxBlockingRegistrants bounds the registrations listed in the deletion blocked condition
+	maxBlockingRegistrants = 10
+	// event reasons
+	reasonDeletionBlocked event.Reason = "DeletionBlocked"
+	// errors
+	errReleaseAll      = "cannot release the registrations of the registry"
+	errListRegisters   = "cannot list the registers of the registry"
+	errDeleteRegisters = "cannot delete the registers of the registry"
+)
+
+// handleDeletionPolicy returns true when the registry can be deleted according
+// to its deletion policy:
+//   - block: deletion waits until all registrations are released and all
+//     registers targeting the registry are gone, the blocking registrations
+//     are reported in the ready condition
+//   - orphan: the pool is dropped, the registers are left behind
+//   - cascade: the registers are deleted and all allocations, including the
+//     grpc allocations without a register, are released
+func (r *application) handleDeletionPolicy(ctx context.Context, cr niv1alpha1.Rg) (bool, error) {
+	log := r.log.WithValues("function", "handleDeletionPolicy", "crname", cr.GetName(), "policy", cr.GetDeletionPolicy())
+	crName := getCrName(cr)
+
+	// the pool is restored from the store when the registry is deleted before
+	// it was reconciled after a restart, a refused shrink keeps the pool
+	if err := r.handler.Init(ctx, crName, cr.GetSize()); err != nil && errors.Cause(err) != handler.ErrPoolShrink {
+		return false, err
+	}
+
+	switch cr.GetDeletionPolicy() {
+	case niv1alpha1.DeletionPolicyOrphan:
+		log.Debug("orphan registrations")
+		return true, nil
+	case niv1alpha1.DeletionPolicyCascade:
+		ctx = audit.WithOrigin(ctx, audit.Origin{Path: audit.PathRegistry})
+		result, err := r.handler.ReleaseAll(ctx, cr.GetNamespace(), crName)
+		if err != nil {
+			return false, errors.Wrap(err, errReleaseAll)
+		}
+		log.Debug("released registrations", "freed", result.Freed, "registrants", result.Registrants)
+		// registers which are not allocated in the pool, e.g. with a memory
+		// store after a restart, are deleted as well
+		if err := r.deleteRegisters(ctx, cr); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	registrants, err := r.getRegistrants(ctx, cr)
+	if err != nil {
+		return false, err
+	}
+	if len(registrants) > 0 {
+		log.Debug("deletion blocked", "registrants", len(registrants))
+		if len(registrants) > maxBlockingRegistrants {
+			registrants = append(registrants[:maxBlockingRegistrants],
+				fmt.Sprintf("and %d more", len(registrants)-maxBlockingRegistrants))
+		}
+		c := niv1alpha1.DeletionBlocked(registrants)
+		cr.SetConditions(c)
+		r.record.Event(cr, event.Warning(reasonDeletionBlocked, errors.New(c.Message)))
+		return false, nil
+	}
+	return true, nil
+}
+
+// getRegistrants returns the sorted names of all registrations in the pool and
+// of the registers targeting the registry, a register which is not allocated in
+// the pool, e.g. with a memory store after a restart, blocks the deletion as well
+func (r *application) getRegistrants(ctx context.Context, cr niv1alpha1.Rg) ([]string, error) {
+	crName := getCrName(cr)
+	registrants := make(map[string]struct{})
+	if allocated, _ := r.handler.GetAllocated(crName); allocated > 0 {
+		result, err := r.handler.Query(crName, "")
+		if err != nil {
+			return nil, errors.Wrap(err, errQueryPool)
+		}
+		for _, e := range result[crName] {
+			for name := range e.Register {
+				registrants[fmt.Sprintf("%s (%s)", name, e.Key)] = struct{}{}
+			}
+		}
+	}
+
+	rrs, err := r.listRegisters(ctx, cr)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range rrs {
+		// the registrant of a register from another namespace is prefixed with its namespace
+		name := rr.GetName()
+		if rr.GetNamespace() != cr.GetNamespace() {
+			name = rr.GetNamespace() + "/" + name
+		}
+		registrants[fmt.Sprintf("%s (%s)", name, rr.GetSelector()["name"])] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(registrants))
+	for name := range registrants {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// listRegisters returns the registers in all namespaces targeting the registry
+func (r *application) listRegisters(ctx context.Context, cr niv1alpha1.Rg) ([]niv1alpha1.Rr, error) {
+	rrl := r.newRegisterList()
+	if err := r.client.List(ctx, rrl); err != nil {
+		return nil, errors.Wrap(err, errListRegisters)
+	}
+	rrs := make([]niv1alpha1.Rr, 0)
+	for _, rr := range rrl.GetRegisters() {
+		if rr.GetRegistryNamespace() != cr.GetNamespace() {
+			continue
+		}
+		registryName := rr.GetRegistryName()
+		if registryName == "" {
+			registryName = rr.GetStatusRegistryName()
+		}
+		if registryName != cr.GetName() {
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// deleteRegisters deletes the registers in all namespaces targeting the registry
+func (r *application) deleteRegisters(ctx context.Context, cr niv1alpha1.Rg) error {
+	rrs, err := r.listRegisters(ctx, cr)
+	if err != nil {
+		return err
+	}
+	for _, rr := range rrs {
+		if err := r.client.Delete(ctx, rr); client.IgnoreNotFound(err) != nil {
+			return errors.Wrap(err, errDeleteRegisters)
+		}
+	}
+	return nil
+}
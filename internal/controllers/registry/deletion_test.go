@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestRegister returns a register of the ni allocating from the registry
+func newTestRegister(namespace, name, registryName, niName string) *niv1alpha1.Register {
+	return &niv1alpha1.Register{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: niv1alpha1.RegisterSpec{
+			RegistryName: utils.StringPtr(registryName),
+			Register: &niv1alpha1.NiRegister{
+				Selector: []*nddov1.Tag{{Key: utils.StringPtr("name"), Value: utils.StringPtr(niName)}},
+			},
+		},
+	}
+}
+
+func TestDeletionPolicyBlock(t *testing.T) {
+	ctx := context.Background()
+	rg := newTestRegistry("rg1", 16, niv1alpha1.LedgerStatus)
+	// the register is not allocated in the pool, e.g. with a memory store after a restart
+	rr := newTestRegister("default", "reg1", "rg1", "blue")
+	other := newTestRegister("default", "reg2", "rg2", "blue")
+	r, c := newTestApplication(t, rg, rr, other)
+
+	ok, err := r.handleDeletionPolicy(ctx, rg)
+	if err != nil || ok {
+		t.Fatalf("a register targeting the registry should block the deletion: %v %v", ok, err)
+	}
+	msg := rg.GetCondition(niv1alpha1.ConditionKindReady).Message
+	if !strings.Contains(msg, "reg1 (blue)") || strings.Contains(msg, "reg2") {
+		t.Errorf("unexpected blocking registrants: %s", msg)
+	}
+
+	// an allocated register is listed once
+	if _, err := r.handler.Register(ctx, testRegisterInfo("reg1", "blue")); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	registrants, err := r.getRegistrants(ctx, rg)
+	if err != nil || len(registrants) != 1 {
+		t.Errorf("unexpected registrants: %v %v", registrants, err)
+	}
+
+	if err := r.handler.DeRegister(ctx, testRegisterInfo("reg1", "blue")); err != nil {
+		t.Fatalf("cannot deregister: %v", err)
+	}
+	if err := c.Delete(ctx, rr); err != nil {
+		t.Fatalf("cannot delete register: %v", err)
+	}
+	ok, err = r.handleDeletionPolicy(ctx, rg)
+	if err != nil || !ok {
+		t.Errorf("the deletion should proceed without registrations: %v %v", ok, err)
+	}
+}
+
+func TestDeletionPolicyCascade(t *testing.T) {
+	ctx := context.Background()
+	rg := newTestRegistry("rg1", 16, niv1alpha1.LedgerStatus)
+	rg.Spec.Registry.DeletionPolicy = utils.StringPtr(niv1alpha1.DeletionPolicyCascade)
+	rr := newTestRegister("default", "reg1", "rg1", "blue")
+	other := newTestRegister("default", "reg2", "rg2", "blue")
+	r, c := newTestApplication(t, rg, rr, other)
+
+	if _, err := r.handler.Register(ctx, testRegisterInfo("grpc1", "red")); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	ok, err := r.handleDeletionPolicy(ctx, rg)
+	if err != nil || !ok {
+		t.Fatalf("the cascade should proceed: %v %v", ok, err)
+	}
+	if allocated, _ := r.handler.GetAllocated(getCrName(rg)); allocated != 0 {
+		t.Errorf("all allocations should be released, got %d", allocated)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "reg1"}, &niv1alpha1.Register{}); !apierrors.IsNotFound(err) {
+		t.Errorf("the register of the registry should be deleted: %v", err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "reg2"}, &niv1alpha1.Register{}); err != nil {
+		t.Errorf("the register of another registry should be kept: %v", err)
+	}
+}
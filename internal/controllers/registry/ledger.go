@@ -0,0 +1,121 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ledgerSuffix = "-ledger"
+	// errors
+	errApplyLedger  = "cannot apply the allocation ledger configmaps"
+	errDeleteLedger = "cannot delete the allocation ledger configmaps"
+)
+
+// handleLedger writes the allocations of the pool to configmaps sharded by
+// index when the registry uses a configmap ledger. The ledger is only rebuilt
+// when the revision of the pool changed since the last write, within a write
+// only the changed shards are applied and the shards without allocations are
+// deleted.
+//
+// The ledger is a read-only view of the pool for users of the registry, it is
+// not used to restore the pool: it lists a bounded amount of registrants per
+// allocation without their source tags. The pool is restored from the store
+// selected with --store, the configmap store shards the pool the same way.
+func (r *application) handleLedger(ctx context.Context, cr niv1alpha1.Rg) error {
+	if cr.GetLedger() != niv1alpha1.LedgerConfigMap {
+		if err := r.deleteLedger(ctx, cr); err != nil {
+			return err
+		}
+		cr.SetLedgerRef(nil)
+		return nil
+	}
+
+	crName := getCrName(cr)
+	revision := r.handler.Revision(crName)
+	r.ledgerMutex.Lock()
+	written, ok := r.ledger[crName]
+	r.ledgerMutex.Unlock()
+	if ok && written.revision == revision {
+		// the pool did not change since the last write
+		cr.SetLedgerRef(written.ref)
+		return nil
+	}
+
+	result, err := r.handler.Query(crName, "")
+	if err != nil {
+		return errors.Wrap(err, errQueryPool)
+	}
+	allocations := make([]*niv1alpha1.NddrRegistryAllocation, 0, len(result[crName]))
+	for _, e := range result[crName] {
+		allocations = append(allocations, newAllocation(e))
+	}
+	shards, err := shardAllocations(allocations)
+	if err != nil {
+		return errors.Wrap(err, errApplyLedger)
+	}
+	prefix := cr.GetName() + ledgerSuffix
+	n, err := r.shards.Write(ctx, cr.GetNamespace(), prefix, metav1.NewControllerRef(cr, niv1alpha1.RegistryGroupVersionKind), shards)
+	if err != nil {
+		return errors.Wrap(err, errApplyLedger)
+	}
+
+	ref := &niv1alpha1.NddrRegistryLedger{
+		ConfigMapPrefix: &prefix,
+		Shards:          utils.Uint32Ptr(uint32(n)),
+		ShardSize:       utils.Uint32Ptr(allocationShardSize),
+	}
+	r.ledgerMutex.Lock()
+	r.ledger[crName] = ledgerWrite{revision: revision, ref: ref}
+	r.ledgerMutex.Unlock()
+	cr.SetLedgerRef(ref)
+	return nil
+}
+
+// ledgerWrite is the last write of the ledger of a registry
+type ledgerWrite struct {
+	// revision of the pool written to the ledger
+	revision uint64
+	ref      *niv1alpha1.NddrRegistryLedger
+}
+
+// deleteLedger deletes the ledger shards if the status refers to a ledger
+func (r *application) deleteLedger(ctx context.Context, cr niv1alpha1.Rg) error {
+	if cr.GetLedgerRef() == nil {
+		return nil
+	}
+	if err := r.shards.Delete(ctx, cr.GetNamespace(), cr.GetName()+ledgerSuffix); err != nil {
+		return errors.Wrap(err, errDeleteLedger)
+	}
+	r.forgetLedger(cr)
+	return nil
+}
+
+// forgetLedger drops what is known about the ledger of a deleted registry, the
+// shards themselves are garbage collected through the owner reference
+func (r *application) forgetLedger(cr niv1alpha1.Rg) {
+	r.ledgerMutex.Lock()
+	defer r.ledgerMutex.Unlock()
+	delete(r.ledger, getCrName(cr))
+	r.shards.Forget(cr.GetNamespace(), cr.GetName()+ledgerSuffix)
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/event"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	"github.com/yndd/nddo-runtime/pkg/resource"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestApplication returns an application with a handler backed by a fake
+// client with the registry, the pool of the registry is initialized
+func newTestApplication(t *testing.T, rg *niv1alpha1.Registry, objs ...client.Object) (*application, client.Client) {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add core scheme: %v", err)
+	}
+	if err := niv1alpha1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add ni scheme: %v", err)
+	}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(append(objs, rg)...).Build()
+	h, err := handler.New(handler.WithLogger(logging.NewNopLogger()), handler.WithClient(c))
+	if err != nil {
+		t.Fatalf("cannot create handler: %v", err)
+	}
+	if err := h.Init(context.Background(), getCrName(rg), rg.GetSize()); err != nil {
+		t.Fatalf("cannot init pool: %v", err)
+	}
+	return &application{
+		client:  resource.ClientApplicator{Client: c, Applicator: resource.NewAPIPatchingApplicator(c)},
+		log:     logging.NewNopLogger(),
+		handler: h,
+		ledger:  make(map[string]ledgerWrite),
+		shards:  store.NewShards(c),
+		record:  event.NewNopRecorder(),
+
+		odaNotFound: make(map[string]string),
+
+		newRegistryList: func() niv1alpha1.RgList { return &niv1alpha1.RegistryList{} },
+		newRegisterList: func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} },
+	}, c
+}
+
+// newTestRegistry returns a ready registry
+func newTestRegistry(name string, size uint32, ledger string) *niv1alpha1.Registry {
+	rg := &niv1alpha1.Registry{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: niv1alpha1.RegistrySpec{
+			Registry: &niv1alpha1.RegistryRegistry{
+				Size:   utils.Uint32Ptr(size),
+				Ledger: utils.StringPtr(ledger),
+			},
+		},
+	}
+	rg.SetConditions(niv1alpha1.Ready())
+	// the status is initialized before the app logic runs
+	_ = rg.InitializeResource()
+	return rg
+}
+
+func testRegisterInfo(name, niName string) *handler.RegisterInfo {
+	return &handler.RegisterInfo{
+		Namespace:    "default",
+		Name:         name,
+		RegistryName: "rg1",
+		CrName:       "default.rg1",
+		Selector:     map[string]string{"name": niName},
+	}
+}
+
+func listLedger(t *testing.T, c client.Client) []corev1.ConfigMap {
+	t.Helper()
+	cml := &corev1.ConfigMapList{}
+	if err := c.List(context.Background(), cml, client.MatchingLabels{store.ShardLabelKey: "rg1" + ledgerSuffix}); err != nil {
+		t.Fatalf("cannot list the ledger: %v", err)
+	}
+	return cml.Items
+}
+
+func TestHandleLedger(t *testing.T) {
+	ctx := context.Background()
+	rg := newTestRegistry("rg1", 4000, niv1alpha1.LedgerConfigMap)
+	r, c := newTestApplication(t, rg)
+
+	for _, niName := range []string{"blue", "red", "green", "yellow"} {
+		if _, err := r.handler.Register(ctx, testRegisterInfo("reg-"+niName, niName)); err != nil {
+			t.Fatalf("cannot register %s: %v", niName, err)
+		}
+	}
+	if err := r.handleLedger(ctx, rg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ref := rg.GetLedgerRef()
+	if ref == nil || int(*ref.Shards) != len(listLedger(t, c)) {
+		t.Fatalf("the ledger ref should count the shards: %v", ref)
+	}
+	entries := 0
+	for _, cm := range listLedger(t, c) {
+		entries += len(cm.Data)
+	}
+	if entries != 4 {
+		t.Errorf("expected 4 allocations in the ledger, got %d", entries)
+	}
+
+	// an unchanged pool is not written again
+	versions := make(map[string]string)
+	for _, cm := range listLedger(t, c) {
+		versions[cm.GetName()] = cm.GetResourceVersion()
+	}
+	if err := r.handleLedger(ctx, rg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, cm := range listLedger(t, c) {
+		if versions[cm.GetName()] != cm.GetResourceVersion() {
+			t.Errorf("shard %s should not be written again", cm.GetName())
+		}
+	}
+
+	// the shards without allocations are deleted
+	for _, niName := range []string{"blue", "red", "green", "yellow"} {
+		if err := r.handler.DeRegister(ctx, testRegisterInfo("reg-"+niName, niName)); err != nil {
+			t.Fatalf("cannot deregister %s: %v", niName, err)
+		}
+	}
+	if err := r.handleLedger(ctx, rg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cms := listLedger(t, c); len(cms) != 0 {
+		t.Errorf("the empty shards should be deleted, got %d", len(cms))
+	}
+
+	// switching back to the status ledger deletes the shards
+	if _, err := r.handler.Register(ctx, testRegisterInfo("reg-blue", "blue")); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	if err := r.handleLedger(ctx, rg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rg.Spec.Registry.Ledger = utils.StringPtr(niv1alpha1.LedgerStatus)
+	if err := r.handleLedger(ctx, rg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cms := listLedger(t, c); len(cms) != 0 || rg.GetLedgerRef() != nil {
+		t.Errorf("the ledger should be deleted, got %d shards", len(cms))
+	}
+}
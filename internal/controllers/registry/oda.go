@@ -0,0 +1,271 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	// org registry resources backing the oda of a registry, named by odns:
+	// <org>, <org>.<deployment> and <org>.<deployment>.<availability-zone>
+	orgGroupVersion                  = schema.GroupVersion{Group: "org.nddr.yndd.io", Version: "v1alpha1"}
+	organizationGroupVersionKind     = orgGroupVersion.WithKind("Organization")
+	deploymentGroupVersionKind       = orgGroupVersion.WithKind("Deployment")
+	availabilityZoneGroupVersionKind = orgGroupVersion.WithKind("AvailabilityZone")
+	odaGroupVersionKinds             = []schema.GroupVersionKind{
+		organizationGroupVersionKind,
+		deploymentGroupVersionKind,
+		availabilityZoneGroupVersionKind,
+	}
+)
+
+type odaObject struct {
+	gvk  schema.GroupVersionKind
+	name string
+}
+
+// validateOda checks that the organization, deployment and availability zone of
+// the registry exist in the org registry. Deployment and availability zone are
+// only checked when the registry specifies them. The check fails open for a
+// kind the api server does not serve, so a cluster without the org registry
+// does not block the registries.
+func (r *application) validateOda(ctx context.Context, cr niv1alpha1.Rg) error {
+	org := cr.GetOrganization()
+	if !isOdaSet(org) {
+		return errors.New("registry has no organization")
+	}
+	checks := []odaObject{{gvk: organizationGroupVersionKind, name: org}}
+	if dep := cr.GetDeployment(); isOdaSet(dep) {
+		checks = append(checks, odaObject{gvk: deploymentGroupVersionKind, name: strings.Join([]string{org, dep}, ".")})
+		if az := cr.GetAvailabilityZone(); isOdaSet(az) {
+			checks = append(checks, odaObject{gvk: availabilityZoneGroupVersionKind, name: strings.Join([]string{org, dep, az}, ".")})
+		}
+	}
+
+	for _, c := range checks {
+		o := &unstructured.Unstructured{}
+		o.SetGroupVersionKind(c.gvk)
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: cr.GetNamespace(), Name: c.name}, o); err != nil {
+			switch {
+			case meta.IsNoMatchError(err):
+				r.log.Debug("org registry kind not served, skip oda check", "kind", c.gvk.Kind)
+				continue
+			case kerrors.IsNotFound(err):
+				return fmt.Errorf("%s %s not found in the org registry", strings.ToLower(c.gvk.Kind), c.name)
+			default:
+				return errors.Wrapf(err, "cannot get %s %s", strings.ToLower(c.gvk.Kind), c.name)
+			}
+		}
+	}
+	return nil
+}
+
+// isOdaSet reports if the oda value is specified, an unset oda value reads as
+// unknown
+func isOdaSet(s string) bool {
+	return s != "" && s != nddov1.OdaKindUnknown.String()
+}
+
+// isOdaNotFound reports if the registry is not ready due to a missing oda
+func isOdaNotFound(cr niv1alpha1.Rg) bool {
+	c := cr.GetCondition(niv1alpha1.ConditionKindReady)
+	return c.Status != corev1.ConditionTrue && c.Reason == niv1alpha1.ConditionReasonOdaNotFound
+}
+
+// EnqueueRequestForOdaRegistries enqueues the registries of an organization
+// when an object of the org registry is created, so registries waiting for
+// their oda become ready without waiting for the poll interval.
+type EnqueueRequestForOdaRegistries struct {
+	client client.Client
+	log    logging.Logger
+	ctx    context.Context
+
+	newRegistryList func() niv1alpha1.RgList
+}
+
+// Create enqueues a request for all registries of the organization.
+func (e *EnqueueRequestForOdaRegistries) Create(evt event.CreateEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+// Update does not enqueue, the name of an org registry object cannot change.
+func (e *EnqueueRequestForOdaRegistries) Update(evt event.UpdateEvent, q workqueue.RateLimitingInterface) {
+}
+
+// Delete enqueues a request for all registries of the organization.
+func (e *EnqueueRequestForOdaRegistries) Delete(evt event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+// Generic enqueues a request for all registries of the organization.
+func (e *EnqueueRequestForOdaRegistries) Generic(evt event.GenericEvent, q workqueue.RateLimitingInterface) {
+	e.add(evt.Object, q)
+}
+
+func (e *EnqueueRequestForOdaRegistries) add(obj runtime.Object, queue adder) {
+	o, ok := obj.(client.Object)
+	if !ok {
+		return
+	}
+	org := strings.Split(o.GetName(), ".")[0]
+	log := e.log.WithValues("function", "watch oda", "name", o.GetName(), "organization", org)
+	log.Debug("oda handleEvent")
+
+	d := e.newRegistryList()
+	if err := e.client.List(e.ctx, d, client.InNamespace(o.GetNamespace())); err != nil {
+		log.Debug("cannot list registries", "error", err)
+		return
+	}
+	for _, registry := range d.GetRegistries() {
+		if registry.GetOrganization() == org {
+			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: registry.GetNamespace(),
+				Name:      registry.GetName()}})
+		}
+	}
+}
+
+// odaWatcher adds the watches of the org registry kinds once the api server
+// serves them, so the org registry can be installed after the controller
+// started
+type odaWatcher struct {
+	controller controller.Controller
+	mapper     meta.RESTMapper
+	handler    *EnqueueRequestForOdaRegistries
+	log        logging.Logger
+
+	watched map[schema.GroupVersionKind]bool
+}
+
+// Start checks the served kinds every odaRetryWait until all kinds are watched
+func (w *odaWatcher) Start(ctx context.Context) error {
+	ticker := time.NewTicker(odaRetryWait)
+	defer ticker.Stop()
+	for {
+		if w.watch() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watch adds the watches of the served kinds and reports if all kinds are watched
+func (w *odaWatcher) watch() bool {
+	for _, gvk := range odaGroupVersionKinds {
+		if w.watched[gvk] {
+			continue
+		}
+		if _, err := w.mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			w.log.Debug("org registry kind not served, retry watch", "kind", gvk.Kind, "error", err)
+			continue
+		}
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(gvk)
+		if err := w.controller.Watch(&source.Kind{Type: u}, w.handler); err != nil {
+			w.log.Debug("cannot watch org registry kind", "kind", gvk.Kind, "error", err)
+			continue
+		}
+		w.log.Debug("org registry kind watched", "kind", gvk.Kind)
+		w.watched[gvk] = true
+	}
+	return len(w.watched) == len(odaGroupVersionKinds)
+}
+
+// setOdaNotFound records the reason the oda of the registry is not found, or
+// forgets it for a nil error
+func (r *application) setOdaNotFound(crName string, err error) {
+	r.odaMutex.Lock()
+	defer r.odaMutex.Unlock()
+	if err == nil {
+		delete(r.odaNotFound, crName)
+		return
+	}
+	r.odaNotFound[crName] = err.Error()
+}
+
+// getOdaNotFound returns the reason the oda of the registry is not found
+func (r *application) getOdaNotFound(crName string) (string, bool) {
+	r.odaMutex.Lock()
+	defer r.odaMutex.Unlock()
+	msg, ok := r.odaNotFound[crName]
+	return msg, ok
+}
+
+// odaManager serves the client of the managed reconciler, which keeps the
+// OdaNotFound condition of the registries
+type odaManager struct {
+	ctrl.Manager
+	client client.Client
+}
+
+func (m *odaManager) GetClient() client.Client {
+	return m.client
+}
+
+// odaStatusClient keeps the OdaNotFound condition in the status writes of the
+// managed reconciler. The managed reconciler marks every registry whose
+// update succeeds as ready, the registry only becomes ready once its oda is
+// found.
+type odaStatusClient struct {
+	client.Client
+	app *application
+}
+
+func (c *odaStatusClient) Status() client.StatusWriter {
+	return &odaStatusWriter{StatusWriter: c.Client.Status(), app: c.app}
+}
+
+type odaStatusWriter struct {
+	client.StatusWriter
+	app *application
+}
+
+func (w *odaStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if cr, ok := obj.(*niv1alpha1.Registry); ok {
+		if msg, ok := w.app.getOdaNotFound(getCrName(cr)); ok {
+			cr.SetConditions(niv1alpha1.OdaNotFound(errors.New(msg)))
+		}
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// unservedClient returns a no match error for the kinds the api server does
+// not serve
+type unservedClient struct {
+	client.Client
+	unserved map[schema.GroupVersionKind]bool
+}
+
+func (c *unservedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if c.unserved[gvk] {
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestValidateOda(t *testing.T) {
+	ctx := context.Background()
+	rg := newTestRegistry("rg1", 16, niv1alpha1.LedgerStatus)
+	r, c := newTestApplication(t, rg)
+	rg.Spec.SetOrganization("nokia")
+
+	// the org registry is not installed, the check fails open
+	r.client.Client = &unservedClient{Client: c, unserved: map[schema.GroupVersionKind]bool{
+		organizationGroupVersionKind: true,
+	}}
+	if err := r.validateOda(ctx, rg); err != nil {
+		t.Errorf("the check should fail open without the org registry: %v", err)
+	}
+
+	// the organization is served, but does not exist
+	r.client.Client = c
+	if err := r.validateOda(ctx, rg); err == nil {
+		t.Errorf("a missing organization should fail the check")
+	}
+}
+
+// fakeController records the watched kinds
+type fakeController struct {
+	watched []schema.GroupVersionKind
+}
+
+func (c *fakeController) Reconcile(context.Context, reconcile.Request) (reconcile.Result, error) {
+	return reconcile.Result{}, nil
+}
+
+func (c *fakeController) Watch(src source.Source, _ handler.EventHandler, _ ...predicate.Predicate) error {
+	if k, ok := src.(*source.Kind); ok {
+		c.watched = append(c.watched, k.Type.(*unstructured.Unstructured).GroupVersionKind())
+	}
+	return nil
+}
+
+func (c *fakeController) Start(context.Context) error { return nil }
+
+func (c *fakeController) GetLogger() logr.Logger { return nil }
+
+func TestOdaWatcher(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{orgGroupVersion})
+	c := &fakeController{}
+	w := &odaWatcher{
+		controller: c,
+		mapper:     mapper,
+		log:        logging.NewNopLogger(),
+		watched:    make(map[schema.GroupVersionKind]bool),
+	}
+
+	// the org registry is not installed
+	if w.watch() || len(c.watched) != 0 {
+		t.Fatalf("no kind should be watched: %v", c.watched)
+	}
+
+	// the org registry is installed after the start
+	for _, gvk := range odaGroupVersionKinds {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	if !w.watch() || len(c.watched) != len(odaGroupVersionKinds) {
+		t.Fatalf("all kinds should be watched: %v", c.watched)
+	}
+	if !w.watch() || len(c.watched) != len(odaGroupVersionKinds) {
+		t.Errorf("a kind should be watched once: %v", c.watched)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/yndd/ndd-runtime/pkg/event"
@@ -29,7 +30,13 @@ import (
 	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
 	"github.com/yndd/nddr-ni-registry/internal/shared"
-	"github.com/yndd/nddr-org-registry/pkg/registry"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	"github.com/yndd/nddr-ni-registry/internal/tracing"
+	"github.com/yndd/nddr-ni-registry/internal/trigger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	gevent "sigs.k8s.io/controller-runtime/pkg/event"
@@ -38,52 +45,65 @@ import (
 
 const (
 	// timers
-	reconcileTimeout = 1 * time.Minute
-	shortWait        = 5 * time.Second
-	veryShortWait    = 1 * time.Second
+	statusDebounce = 1 * time.Second
+	statusMaxWait  = 5 * time.Second
+	odaRetryWait   = 10 * time.Second
 	// errors
 	errUnexpectedResource = "unexpected infrastructure object"
 	errGetK8sResource     = "cannot get infrastructure resource"
+	// infoPoll is the info key which requeues the registry after the poll interval
+	infoPoll = "poll"
+	// infoOda is the info key of a registry waiting for its oda
+	infoOda = "oda"
 )
 
+var tracer = tracing.Tracer("registry")
+
 // Setup adds a controller that reconciles infra.
 func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControllerOptions) (string, chan gevent.GenericEvent, error) {
 	name := "nddo/" + strings.ToLower(niv1alpha1.RegistryGroupKind)
 	rgfn := func() niv1alpha1.Rg { return &niv1alpha1.Registry{} }
 	rglfn := func() niv1alpha1.RgList { return &niv1alpha1.RegistryList{} }
 	//rrfn := func() niv1alpha1.Rr { return &niv1alpha1.Register{} }
-	//rrlfn := func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} }
+	rrlfn := func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} }
 
-	events := make(chan gevent.GenericEvent)
-	//speedy := make(map[string]int)
+	recorder := event.NewAPIRecorder(mgr.GetEventRecorderFor(name))
 
-	r := managed.NewReconciler(mgr,
+	events := make(chan gevent.GenericEvent)
+	// pool changes trigger a debounced status refresh of the registry
+	t := trigger.New(events, statusDebounce, statusMaxWait)
+	nddcopts.Handler.WithTrigger(t)
+
+	app := &application{
+		client: resource.ClientApplicator{
+			Client:     mgr.GetClient(),
+			Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
+		},
+		log:             nddcopts.Logger.WithValues("applogic", name),
+		newRegistry:     rgfn,
+		newRegistryList: rglfn,
+		newRegisterList: rrlfn,
+		handler:         nddcopts.Handler,
+		trigger:         t,
+		pollInterval:    nddcopts.Poll,
+		validateOdaOpt:  nddcopts.ValidateOda,
+		ledger:          make(map[string]ledgerWrite),
+		shards:          store.NewShards(mgr.GetClient()),
+		record:          recorder,
+		odaNotFound:     make(map[string]string),
+	}
+	r := managed.NewReconciler(&odaManager{Manager: mgr, client: &odaStatusClient{Client: mgr.GetClient(), app: app}},
 		resource.ManagedKind(niv1alpha1.RegistryGroupVersionKind),
 		managed.WithLogger(nddcopts.Logger.WithValues("controller", name)),
-		managed.WithApplication(&application{
-			client: resource.ClientApplicator{
-				Client:     mgr.GetClient(),
-				Applicator: resource.NewAPIPatchingApplicator(mgr.GetClient()),
-			},
-			log:             nddcopts.Logger.WithValues("applogic", name),
-			newRegistry:     rgfn,
-			newRegistryList: rglfn,
-			registry:        nddcopts.Registry,
-			handler:         nddcopts.Handler,
-		}),
-		//managed.WithSpeedy(speedy),
-		managed.WithRecorder(event.NewAPIRecorder(mgr.GetEventRecorderFor(name))),
+		managed.WithApplication(app),
+		managed.WithRecorder(recorder),
 	)
 
 	registerHandler := &EnqueueRequestForAllRegisters{
-		client:          mgr.GetClient(),
-		log:             nddcopts.Logger,
-		ctx:             context.Background(),
-		handler:         nddcopts.Handler,
-		newRegistryList: rglfn,
+		log: nddcopts.Logger,
 	}
 
-	return niv1alpha1.RegistryGroupKind, events, ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named(name).
 		WithOptions(o).
 		For(&niv1alpha1.Registry{}).
@@ -91,9 +111,28 @@ func Setup(mgr ctrl.Manager, o controller.Options, nddcopts *shared.NddControlle
 		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
 		Watches(&source.Kind{Type: &niv1alpha1.Register{}}, registerHandler).
 		Watches(&source.Channel{Source: events}, registerHandler).
-		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate()).
-		Complete(r)
+		WithEventFilter(resource.IgnoreUpdateWithoutGenerationChangePredicate())
 
+	c, err := b.Build(r)
+	if err != nil {
+		return niv1alpha1.RegistryGroupKind, events, err
+	}
+	if !nddcopts.ValidateOda {
+		return niv1alpha1.RegistryGroupKind, events, nil
+	}
+	// the org registry kinds are watched once they are served
+	return niv1alpha1.RegistryGroupKind, events, mgr.Add(&odaWatcher{
+		controller: c,
+		mapper:     mgr.GetRESTMapper(),
+		handler: &EnqueueRequestForOdaRegistries{
+			client:          mgr.GetClient(),
+			log:             nddcopts.Logger,
+			ctx:             context.Background(),
+			newRegistryList: rglfn,
+		},
+		log:     nddcopts.Logger.WithValues("function", "watch oda"),
+		watched: make(map[schema.GroupVersionKind]bool),
+	})
 }
 
 type application struct {
@@ -102,9 +141,26 @@ type application struct {
 
 	newRegistry     func() niv1alpha1.Rg
 	newRegistryList func() niv1alpha1.RgList
-
-	registry registry.Registry
-	handler  handler.Handler
+	newRegisterList func() niv1alpha1.RrList
+
+	handler      handler.Handler
+	pollInterval time.Duration
+	// trigger links the reconcile to the spans of the pool changes triggering it
+	trigger trigger.Trigger
+	// validateOdaOpt validates the oda against the org registry before the registry becomes ready
+	validateOdaOpt bool
+	// record emits the deletion events on the registry
+	record event.Recorder
+
+	// last write of the ledger per registry crName
+	ledgerMutex sync.Mutex
+	ledger      map[string]ledgerWrite
+	// shards writes the ledger and the allocations which do not fit in the status
+	shards *store.Shards
+
+	// reason per registry crName why its oda is not found
+	odaMutex    sync.Mutex
+	odaNotFound map[string]string
 }
 
 func getCrName(cr niv1alpha1.Rg) string {
@@ -131,7 +187,18 @@ func (r *application) Update(ctx context.Context, mg resource.Managed) (map[stri
 		return nil, errors.New(errUnexpectedResource)
 	}
 
-	return r.handleAppLogic(ctx, cr)
+	crName := getCrName(cr)
+	ctx, span := tracer.Start(ctx, "registry.Update",
+		trace.WithLinks(r.trigger.Links(crName)...),
+		trace.WithAttributes(attribute.String("registry.crname", crName)),
+	)
+	defer span.End()
+	info, err := r.handleAppLogic(ctx, cr)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return info, err
 }
 
 func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
@@ -141,21 +208,12 @@ func (r *application) FinalUpdate(ctx context.Context, mg resource.Managed) {
 }
 
 func (r *application) Timeout(ctx context.Context, mg resource.Managed) time.Duration {
-	cr, _ := mg.(*niv1alpha1.Registry)
-	crName := getCrName(cr)
-	speedy := r.handler.GetSpeedy(crName)
-	if speedy <= 2 {
-		r.handler.IncrementSpeedy(crName)
-		r.log.Debug("Speedy incr", "number", r.handler.GetSpeedy(crName))
-		switch speedy {
-		case 0:
-			return veryShortWait
-		case 1, 2:
-			return shortWait
-		}
-
+	if cr, ok := mg.(*niv1alpha1.Registry); ok && isOdaNotFound(cr) {
+		// retry sooner for a registry waiting for its oda in the org registry
+		return odaRetryWait
 	}
-	return reconcileTimeout
+	// status refreshes are triggered by pool changes, the poll interval only checks for drift
+	return r.pollInterval
 }
 
 func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, error) {
@@ -163,41 +221,66 @@ func (r *application) Delete(ctx context.Context, mg resource.Managed) (bool, er
 	if !ok {
 		return false, errors.New(errUnexpectedResource)
 	}
-	crName := getCrName(cr)
 
-	allocated, _ := r.handler.GetAllocated(crName)
-	if allocated > 0 {
-		return false, nil
-	}
-	return true, nil
+	return r.handleDeletionPolicy(ctx, cr)
 }
 
 func (r *application) FinalDelete(ctx context.Context, mg resource.Managed) {
 	cr, _ := mg.(*niv1alpha1.Registry)
 	crName := getCrName(cr)
-	r.handler.Delete(crName)
+	if err := r.handler.Delete(ctx, crName); err != nil {
+		r.log.Debug("cannot delete pool", "crname", crName, "error", err)
+	}
+	r.forgetLedger(cr)
+	r.setOdaNotFound(crName, nil)
+	r.shards.Forget(cr.GetNamespace(), cr.GetName()+overflowSuffix)
 }
 
 func (r *application) handleAppLogic(ctx context.Context, cr niv1alpha1.Rg) (map[string]string, error) {
 	log := r.log.WithValues("function", "handleAppLogic", "crname", cr.GetName())
 	log.Debug("handleAppLogic")
 
-	//organizationName := cr.GetOrganizationName()
+	// the registry only becomes ready when its oda exists in the org registry
+	if r.validateOdaOpt {
+		err := r.validateOda(ctx, cr)
+		r.setOdaNotFound(getCrName(cr), err)
+		if err != nil {
+			// no error, the managed reconciler would replace the condition
+			// and requeue with its backoff instead of Timeout
+			log.Debug("oda validation failed", "error", err)
+			cr.SetConditions(niv1alpha1.OdaNotFound(err))
+			return map[string]string{infoOda: err.Error()}, nil
+		}
+	}
 
-	// initialize speedy
+	// initialize the pool
 	crName := getCrName(cr)
-	r.handler.Init(crName, cr.GetSize())
+	if err := r.handler.Init(ctx, crName, cr.GetSize()); err != nil {
+		return nil, err
+	}
 	// update status based on a scan of the pool
 
 	allocated, used := r.handler.GetAllocated(crName)
 	log.Debug("handleAppLogic", "allocated", allocated, "used", used)
+	if cr.GetLedger() == niv1alpha1.LedgerConfigMap {
+		// the allocations are kept in the ledger, the status only carries the counters
+		used = nil
+	}
 	cr.SetStatus(allocated, used)
+	r.handleCapacity(cr, allocated)
+	if err := r.handleLedger(ctx, cr); err != nil {
+		return nil, err
+	}
+	if err := r.handleStatusDetail(ctx, cr); err != nil {
+		return nil, err
+	}
 
 	cr.SetOrganization(cr.GetOrganization())
 	cr.SetDeployment(cr.GetDeployment())
 	cr.SetAvailabilityZone(cr.GetAvailabilityZone())
 	cr.SetRegistryName(cr.GetRegistryName())
 
-	// trick to use speedy for fast updates
-	return map[string]string{"dummy": "dummy"}, nil
+	// the managed reconciler only consults Timeout for a non-empty info map,
+	// without it every registry requeues after its fixed reconcile timeout
+	return map[string]string{infoPoll: r.pollInterval.String()}, nil
 }
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yndd/nddo-runtime/pkg/reconciler/managed"
+	"github.com/yndd/nddo-runtime/pkg/resource"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/trigger"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gevent "sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// testManager serves the client and scheme the managed reconciler needs
+type testManager struct {
+	manager.Manager
+	client client.Client
+}
+
+func (m *testManager) GetClient() client.Client { return m.client }
+
+func (m *testManager) GetScheme() *runtime.Scheme { return m.client.Scheme() }
+
+// newTestReconciler returns the managed reconciler of the application, as
+// Setup builds it
+func newTestReconciler(r *application, c client.Client) *managed.Reconciler {
+	r.trigger = trigger.New(make(chan gevent.GenericEvent), time.Second, time.Second)
+	return managed.NewReconciler(&testManager{client: &odaStatusClient{Client: c, app: r}},
+		resource.ManagedKind(niv1alpha1.RegistryGroupVersionKind),
+		managed.WithApplication(r),
+	)
+}
+
+func TestReconcilePollInterval(t *testing.T) {
+	rg := newTestRegistry("rg1", 16, niv1alpha1.LedgerStatus)
+	r, c := newTestApplication(t, rg)
+	r.pollInterval = 3 * time.Minute
+
+	result, err := newTestReconciler(r, c).Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "rg1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != r.pollInterval {
+		t.Errorf("expected a requeue after the poll interval %v, got %v", r.pollInterval, result.RequeueAfter)
+	}
+}
+
+func TestReconcileOdaNotFound(t *testing.T) {
+	ctx := context.Background()
+	rg := newTestRegistry("rg1", 16, niv1alpha1.LedgerStatus)
+	rg.Spec.SetOrganization("nokia")
+	r, c := newTestApplication(t, rg)
+	r.validateOdaOpt = true
+	reconciler := newTestReconciler(r, c)
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "rg1"}}
+
+	// the organization does not exist
+	result, err := reconciler.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.RequeueAfter != odaRetryWait {
+		t.Errorf("expected a requeue after %v, got %v", odaRetryWait, result.RequeueAfter)
+	}
+	got := &niv1alpha1.Registry{}
+	if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatalf("cannot get registry: %v", err)
+	}
+	if cond := got.GetCondition(niv1alpha1.ConditionKindReady); cond.Reason != niv1alpha1.ConditionReasonOdaNotFound || cond.Message == "" {
+		t.Errorf("the registry should not be ready due to its oda: %v", cond)
+	}
+
+	// the org registry is not installed, the check fails open
+	r.client.Client = &unservedClient{Client: c, unserved: map[schema.GroupVersionKind]bool{
+		organizationGroupVersionKind: true,
+	}}
+	if _, err := reconciler.Reconcile(ctx, req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+		t.Fatalf("cannot get registry: %v", err)
+	}
+	if cond := got.GetCondition(niv1alpha1.ConditionKindReady); cond.Reason != niv1alpha1.ConditionReasonReady {
+		t.Errorf("the registry should be ready: %v", cond)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	overflowSuffix = "-allocations"
+	// allocationShardSize is the amount of indexes per configmap shard of the
+	// overflow and the ledger
+	allocationShardSize = 500
+	// maxAllocationRegistrants bounds the registrants listed per allocation
+	maxAllocationRegistrants = 10
+	// errors
+	errQueryPool      = "cannot query the pool"
+	errApplyOverflow  = "cannot apply the allocation overflow configmaps"
+	errDeleteOverflow = "cannot delete the allocation overflow configmaps"
+)
+
+// handleStatusDetail reports the allocations in the status when the registry
+// requests a detailed status. The amount of allocations in the status is bounded
+// by status-max-entries, the remaining allocations are stored in configmaps
+// sharded by index and owned by the registry.
+func (r *application) handleStatusDetail(ctx context.Context, cr niv1alpha1.Rg) error {
+	// with a configmap ledger the status only carries the counters
+	if cr.GetStatusDetail() != niv1alpha1.StatusDetailDetailed || cr.GetLedger() == niv1alpha1.LedgerConfigMap {
+		if err := r.deleteOverflow(ctx, cr); err != nil {
+			return err
+		}
+		cr.SetAllocations(nil, nil)
+		return nil
+	}
+
+	crName := getCrName(cr)
+	result, err := r.handler.Query(crName, "")
+	if err != nil {
+		return errors.Wrap(err, errQueryPool)
+	}
+	allocations := make([]*niv1alpha1.NddrRegistryAllocation, 0, len(result[crName]))
+	for _, e := range result[crName] {
+		allocations = append(allocations, newAllocation(e))
+	}
+
+	max := int(cr.GetStatusMaxEntries())
+	if len(allocations) <= max {
+		if err := r.deleteOverflow(ctx, cr); err != nil {
+			return err
+		}
+		cr.SetAllocations(allocations, nil)
+		return nil
+	}
+
+	shards, err := shardAllocations(allocations[max:])
+	if err != nil {
+		return errors.Wrap(err, errApplyOverflow)
+	}
+	prefix := cr.GetName() + overflowSuffix
+	n, err := r.shards.Write(ctx, cr.GetNamespace(), prefix, metav1.NewControllerRef(cr, niv1alpha1.RegistryGroupVersionKind), shards)
+	if err != nil {
+		return errors.Wrap(err, errApplyOverflow)
+	}
+
+	cr.SetAllocations(allocations[:max], &niv1alpha1.NddrRegistryOverflow{
+		Entries:         utils.Uint32Ptr(uint32(len(allocations) - max)),
+		ConfigMapPrefix: &prefix,
+		Shards:          utils.Uint32Ptr(uint32(n)),
+		ShardSize:       utils.Uint32Ptr(allocationShardSize),
+	})
+	return nil
+}
+
+// deleteOverflow deletes the overflow shards if the status refers to them
+func (r *application) deleteOverflow(ctx context.Context, cr niv1alpha1.Rg) error {
+	if cr.GetOverflow() == nil {
+		return nil
+	}
+	if err := r.shards.Delete(ctx, cr.GetNamespace(), cr.GetName()+overflowSuffix); err != nil {
+		return errors.Wrap(err, errDeleteOverflow)
+	}
+	return nil
+}
+
+// shardAllocations returns the encoded allocations keyed by index per shard
+func shardAllocations(allocations []*niv1alpha1.NddrRegistryAllocation) (map[int]map[string]string, error) {
+	shards := make(map[int]map[string]string)
+	for _, a := range allocations {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		index := *a.Index
+		shard := int(index / allocationShardSize)
+		if _, ok := shards[shard]; !ok {
+			shards[shard] = make(map[string]string)
+		}
+		shards[shard][strconv.Itoa(int(index))] = string(data)
+	}
+	return shards, nil
+}
+
+// newAllocation returns the allocation of the entry, at most
+// maxAllocationRegistrants registrants are listed
+func newAllocation(e *hash.Entry) *niv1alpha1.NddrRegistryAllocation {
+	key := e.Key
+	names := make([]string, 0, len(e.Register))
+	for name := range e.Register {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	count := len(names)
+	if len(names) > maxAllocationRegistrants {
+		names = names[:maxAllocationRegistrants]
+	}
+	registrants := make([]*string, 0, len(names))
+	for _, name := range names {
+		name := name
+		registrants = append(registrants, &name)
+	}
+	return &niv1alpha1.NddrRegistryAllocation{
+		Index:           utils.Uint32Ptr(e.Index),
+		Key:             &key,
+		RegistrantCount: utils.Uint32Ptr(uint32(count)),
+		Registrants:     registrants,
+	}
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestNewAllocation(t *testing.T) {
+	e := &hash.Entry{Index: 3, Key: "blue", Register: make(map[string]labels.Set)}
+	for i := 0; i < maxAllocationRegistrants+5; i++ {
+		e.Register[fmt.Sprintf("reg%02d", i)] = nil
+	}
+	a := newAllocation(e)
+	if *a.RegistrantCount != uint32(maxAllocationRegistrants+5) {
+		t.Errorf("the count should hold all registrants, got %d", *a.RegistrantCount)
+	}
+	if len(a.Registrants) != maxAllocationRegistrants {
+		t.Errorf("expected %d registrants, got %d", maxAllocationRegistrants, len(a.Registrants))
+	}
+	if *a.Registrants[0] != "reg00" {
+		t.Errorf("the registrants should be sorted, got %s", *a.Registrants[0])
+	}
+}
+
+func TestShardAllocations(t *testing.T) {
+	allocations := make([]*niv1alpha1.NddrRegistryAllocation, 0)
+	for _, index := range []uint32{1, allocationShardSize + 1, allocationShardSize + 2} {
+		allocations = append(allocations, newAllocation(&hash.Entry{Index: index}))
+	}
+	shards, err := shardAllocations(allocations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(shards) != 2 || len(shards[0]) != 1 || len(shards[1]) != 2 {
+		t.Errorf("unexpected shards: %v", shards)
+	}
+}
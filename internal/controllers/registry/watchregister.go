@@ -17,17 +17,12 @@ limitations under the License.
 package registry
 
 import (
-	"context"
-
 	//ndddvrv1 "github.com/yndd/ndd-core/apis/dvr/v1"
 	"github.com/yndd/ndd-runtime/pkg/logging"
-	"github.com/yndd/nddo-runtime/pkg/odns"
 	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
-	"github.com/yndd/nddr-ni-registry/internal/handler"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/workqueue"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -37,14 +32,7 @@ type adder interface {
 }
 
 type EnqueueRequestForAllRegisters struct {
-	client client.Client
-	log    logging.Logger
-	ctx    context.Context
-
-	handler handler.Handler
-	//mutex  sync.Mutex
-
-	newRegistryList func() niv1alpha1.RgList
+	log logging.Logger
 }
 
 // Create enqueues a request for all infrastructures which pertains to the topology.
@@ -69,6 +57,13 @@ func (e *EnqueueRequestForAllRegisters) Generic(evt event.GenericEvent, q workqu
 }
 
 func (e *EnqueueRequestForAllRegisters) add(obj runtime.Object, queue adder) {
+	// a registry event, e.g. from the pool change trigger, enqueues the registry directly
+	if rg, ok := obj.(*niv1alpha1.Registry); ok {
+		queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: rg.GetNamespace(),
+			Name:      rg.GetName()}})
+		return
+	}
 	dd, ok := obj.(*niv1alpha1.Register)
 	if !ok {
 		return
@@ -76,24 +71,18 @@ func (e *EnqueueRequestForAllRegisters) add(obj runtime.Object, queue adder) {
 	log := e.log.WithValues("function", "watch register", "name", dd.GetName())
 	log.Debug("register handleEvent")
 
-	d := e.newRegistryList()
-	if err := e.client.List(e.ctx, d); err != nil {
-		return
+	// a register maps directly to the registry it targets, so there is no need
+	// to list all registries for every register event
+	registryName := dd.GetRegistryName()
+	if registryName == "" {
+		// a register selecting its registry by oda maps to the registry it was resolved to
+		registryName = dd.GetStatusRegistryName()
 	}
-
-	registryName := odns.Name2OdnsRegistry(dd.GetName()).GetRegistryName()
-
-	for _, registry := range d.GetRegistries() {
-		log.Debug("watch register event", "name", dd.GetName(), "namespace", dd.GetNamespace())
-
-		// only enqueue if the org and/or deployment name match
-		if registry.GetName() == registryName {
-			crName := getCrName(registry)
-			e.handler.ResetSpeedy(crName)
-
-			queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
-				Namespace: registry.GetNamespace(),
-				Name:      registry.GetName()}})
-		}
+	if registryName == "" {
+		return
 	}
+	log.Debug("watch register event", "registry", registryName, "namespace", dd.GetRegistryNamespace())
+	queue.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+		Namespace: dd.GetRegistryNamespace(),
+		Name:      registryName}})
 }
@@ -18,36 +18,208 @@ package grpcserver
 
 import (
 	"context"
+	"encoding/json"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/yndd/nddo-grpc/resource/resourcepb"
-	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/controller-runtime/pkg/event"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
 )
 
+const (
+	// selector keys of a ResourceGet request
+	selectorKeyIndex             = "index"
+	selectorKeySourceTagSelector = "source-tag-selector"
+	selectorKeyExport            = "export"
+	// selector key to check the consistency of the pools: an empty value in a
+	// ResourceGet reports the inconsistencies, repair in a ResourceRequest
+	// repairs them and release-orphans in a ResourceRelease repairs them and
+	// releases the registrations without register as well
+	selectorKeyCheck = "check"
+	// selector key of a ResourceRequest request carrying the json snapshots to import
+	selectorKeyImport = "import"
+	// selector key of a request to access a registry in another namespace than
+	// the one of the request, the allow-list of the registry must permit the
+	// namespace of the request
+	selectorKeyRegistryNamespace = "registry-namespace"
+
+	// check modes
+	checkModeRepair         = "repair"
+	checkModeReleaseOrphans = "release-orphans"
+)
+
+// newRegisterInfo returns the register info of a request, the namespace of the
+// request is the requester namespace, the registry namespace defaults to it.
+//
+// Every request is checked against the allow-list of the registries it
+// touches: allocate and release through the handler, query, export, check and
+// import through Permit and bulk release before the registers are deleted.
+//
+// The namespace of a request is supplied by the client and not authenticated,
+// the allow-list of a registry keeps well-behaved clients within their
+// namespaces but cannot stop a client claiming another namespace. Access to
+// the grpc port must be restricted, e.g. with a network policy, where this
+// matters.
+func newRegisterInfo(req *resourcepb.Request) *handler.RegisterInfo {
+	registryNamespace := getRegistryNamespace(req)
+	return &handler.RegisterInfo{
+		Namespace:          registryNamespace,
+		RequesterNamespace: req.GetNamespace(),
+		RegistryName:       req.GetRegistryName(),
+		Name:               req.GetName(),
+		CrName:             strings.Join([]string{registryNamespace, req.GetRegistryName()}, "."),
+		Selector:           req.Request.Selector,
+		SourceTag:          req.Request.SourceTag,
+	}
+}
+
+// getRegistryNamespace returns the namespace of the registry of a request, the
+// registry-namespace selector key defaults to the namespace of the request
+func getRegistryNamespace(req *resourcepb.Request) string {
+	if ns, ok := req.GetRequest().GetSelector()[selectorKeyRegistryNamespace]; ok && ns != "" {
+		return ns
+	}
+	return req.GetNamespace()
+}
+
+// permittedPools returns the crNames of the pools the request may access: the
+// pool of the registry of the request, or all pools whose allow-list permits
+// the namespace of the request when the request has no registry name
+func (r *server) permittedPools(ctx context.Context, req *resourcepb.Request) ([]string, error) {
+	if req.GetRegistryName() == "" {
+		return r.handler.Permitted(ctx, req.GetNamespace())
+	}
+	crName := strings.Join([]string{getRegistryNamespace(req), req.GetRegistryName()}, ".")
+	if err := r.handler.Permit(ctx, req.GetNamespace(), crName); err != nil {
+		return nil, err
+	}
+	return []string{crName}, nil
+}
+
 func (r *server) ResourceGet(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
 	log := r.log.WithValues("Request", req)
 	log.Debug("ResourceGet...")
 
+	crNames, err := r.permittedPools(ctx, req)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	// reverse lookup: index -> ni name and registrants
+	if idx, ok := req.GetRequest().GetSelector()[selectorKeyIndex]; ok {
+		if req.GetRegistryName() == "" {
+			return &resourcepb.Reply{Ready: false}, errors.New("registry name not set")
+		}
+		index, err := strconv.ParseUint(idx, 10, 32)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, errors.Wrap(err, "invalid index")
+		}
+		entry, err := r.handler.GetByIndex(crNames[0], uint32(index))
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		registrants, err := json.Marshal(entry.Register)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		return &resourcepb.Reply{
+			Ready:     true,
+			Timestamp: time.Now().UnixNano(),
+			Data: map[string]*resourcepb.TypedValue{
+				"index":       {Value: &resourcepb.TypedValue_StringVal{StringVal: strconv.Itoa(int(entry.Index))}},
+				"name":        {Value: &resourcepb.TypedValue_StringVal{StringVal: entry.Key}},
+				"registrants": {Value: &resourcepb.TypedValue_StringVal{StringVal: string(registrants)}},
+			},
+		}, nil
+	}
+
+	// check: consistency of the pools with the registers, an empty registry name checks all permitted registries
+	if mode, ok := req.GetRequest().GetSelector()[selectorKeyCheck]; ok {
+		if mode != "" {
+			// a get is read-only, the repairs change the pools
+			return &resourcepb.Reply{Ready: false}, errors.Errorf("check mode %s changes the pools, request %s through ResourceRequest and %s through ResourceRelease", mode, checkModeRepair, checkModeReleaseOrphans)
+		}
+		return r.resourceCheck(ctx, crNames, handler.CheckOptions{})
+	}
+
+	// export: snapshots of the pools, an empty registry name exports all permitted registries
+	if _, ok := req.GetRequest().GetSelector()[selectorKeyExport]; ok {
+		snapshots := make([]*handler.PoolSnapshot, 0, len(crNames))
+		for _, crName := range crNames {
+			s, err := r.handler.Export(crName)
+			if err != nil {
+				return &resourcepb.Reply{Ready: false}, err
+			}
+			snapshots = append(snapshots, s...)
+		}
+		data, err := json.Marshal(snapshots)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		return &resourcepb.Reply{
+			Ready:     true,
+			Timestamp: time.Now().UnixNano(),
+			Data: map[string]*resourcepb.TypedValue{
+				"snapshots": {Value: &resourcepb.TypedValue_StringVal{StringVal: string(data)}},
+			},
+		}, nil
+	}
+
+	// query: source-tag label selector -> entries, an empty registry name queries all permitted registries
+	if selector, ok := req.GetRequest().GetSelector()[selectorKeySourceTagSelector]; ok {
+		result := make(map[string][]*hash.Entry)
+		for _, crName := range crNames {
+			entries, err := r.handler.Query(crName, selector)
+			if err != nil {
+				return &resourcepb.Reply{Ready: false}, err
+			}
+			// like a query of all pools, a pool without matching entries is
+			// only reported when it is queried by name
+			if len(entries[crName]) > 0 || req.GetRegistryName() != "" {
+				result[crName] = entries[crName]
+			}
+		}
+		entries, err := json.Marshal(result)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		return &resourcepb.Reply{
+			Ready:     true,
+			Timestamp: time.Now().UnixNano(),
+			Data: map[string]*resourcepb.TypedValue{
+				"entries": {Value: &resourcepb.TypedValue_StringVal{StringVal: string(entries)}},
+			},
+		}, nil
+	}
+
 	return &resourcepb.Reply{Ready: true}, nil
 }
 
 func (r *server) ResourceRequest(ctx context.Context, req *resourcepb.Request) (*resourcepb.Reply, error) {
 	log := r.log.WithValues("Request", req)
 
-	registerInfo := &handler.RegisterInfo{
-		Namespace:    req.GetNamespace(),
-		RegistryName: req.GetRegistryName(),
-		Name:         req.GetName(),
-		CrName:       strings.Join([]string{req.GetNamespace(), req.GetRegistryName()}, "."),
-		Selector:     req.Request.Selector,
-		SourceTag:    req.Request.SourceTag,
+	// import of the snapshots of an export
+	if data, ok := req.GetRequest().GetSelector()[selectorKeyImport]; ok {
+		return r.resourceImport(ctx, req, data)
 	}
 
+	// repair of the inconsistencies of the pools with the registers
+	if mode, ok := req.GetRequest().GetSelector()[selectorKeyCheck]; ok {
+		if mode != checkModeRepair {
+			return &resourcepb.Reply{Ready: false}, errors.Errorf("invalid check mode %s, expected %s", mode, checkModeRepair)
+		}
+		crNames, err := r.permittedPools(ctx, req)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		return r.resourceCheck(ctx, crNames, handler.CheckOptions{Repair: true})
+	}
+
+	registerInfo := newRegisterInfo(req)
+
 	log.Debug("resource alloc", "registerInfo", registerInfo)
 
 	index, err := r.handler.Register(ctx, registerInfo)
@@ -55,13 +227,6 @@ func (r *server) ResourceRequest(ctx context.Context, req *resourcepb.Request) (
 		return &resourcepb.Reply{Ready: false}, err
 	}
 
-	// send a generic event to trigger a registry reconciliation based on a new allocation
-	r.eventChs[niv1alpha1.RegistryGroupKind] <- event.GenericEvent{
-		Object: &niv1alpha1.Register{
-			ObjectMeta: metav1.ObjectMeta{Name: req.GetName(), Namespace: req.GetNamespace()},
-		},
-	}
-
 	return &resourcepb.Reply{
 		Ready:      true,
 		Timestamp:  time.Now().UnixNano(),
@@ -76,27 +241,122 @@ func (r *server) ResourceRelease(ctx context.Context, req *resourcepb.Request) (
 	log := r.log.WithValues("Request", req)
 	log.Debug("ResourceDeAlloc...")
 
-	registerInfo := &handler.RegisterInfo{
-		Namespace:    req.GetNamespace(),
-		RegistryName: req.GetRegistryName(),
-		CrName:       strings.Join([]string{req.GetNamespace(), req.GetRegistryName()}, "."),
-		Name:         req.GetName(),
-		Selector:     req.Request.Selector,
-		SourceTag:    req.Request.SourceTag,
+	// bulk release of all registrations matching a source-tag label selector
+	if selector, ok := req.GetRequest().GetSelector()[selectorKeySourceTagSelector]; ok {
+		return r.resourceReleaseBySelector(ctx, req, selector)
+	}
+
+	// repair and release of the registrations without register
+	if mode, ok := req.GetRequest().GetSelector()[selectorKeyCheck]; ok {
+		if mode != checkModeReleaseOrphans {
+			return &resourcepb.Reply{Ready: false}, errors.Errorf("invalid check mode %s, expected %s", mode, checkModeReleaseOrphans)
+		}
+		crNames, err := r.permittedPools(ctx, req)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		return r.resourceCheck(ctx, crNames, handler.CheckOptions{Repair: true, ReleaseOrphans: true})
 	}
 
+	registerInfo := newRegisterInfo(req)
+
 	log.Debug("resource dealloc", "registerInfo", registerInfo)
 
 	if err := r.handler.DeRegister(ctx, registerInfo); err != nil {
 		return &resourcepb.Reply{Ready: false}, err
 	}
 
-	// send a generic event to trigger a registry reconciliation based on a new DeAllocation
-	r.eventChs[niv1alpha1.RegistryGroupKind] <- event.GenericEvent{
-		Object: &niv1alpha1.Register{
-			ObjectMeta: metav1.ObjectMeta{Name: req.GetName(), Namespace: req.GetNamespace()},
+	return &resourcepb.Reply{Ready: true}, nil
+}
+
+func (r *server) resourceReleaseBySelector(ctx context.Context, req *resourcepb.Request, selector string) (*resourcepb.Reply, error) {
+	log := r.log.WithValues("Request", req)
+	log.Debug("resource dealloc by selector", "selector", selector)
+
+	registryNamespace := getRegistryNamespace(req)
+	crName := strings.Join([]string{registryNamespace, req.GetRegistryName()}, ".")
+	// the release deletes the registers owning the registrations, it is
+	// limited to the registries which permit the requester namespace
+	if err := r.handler.Permit(ctx, req.GetNamespace(), crName); err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+	result, err := r.handler.ReleaseBySelector(ctx, registryNamespace, crName, selector)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	freed, err := json.Marshal(result.Freed)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+	retained, err := json.Marshal(result.Retained)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+	registrants, err := json.Marshal(result.Registrants)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	return &resourcepb.Reply{
+		Ready:     true,
+		Timestamp: time.Now().UnixNano(),
+		Data: map[string]*resourcepb.TypedValue{
+			"freed":       {Value: &resourcepb.TypedValue_StringVal{StringVal: string(freed)}},
+			"retained":    {Value: &resourcepb.TypedValue_StringVal{StringVal: string(retained)}},
+			"registrants": {Value: &resourcepb.TypedValue_StringVal{StringVal: string(registrants)}},
 		},
+	}, nil
+}
+
+func (r *server) resourceImport(ctx context.Context, req *resourcepb.Request, data string) (*resourcepb.Reply, error) {
+	snapshots := make([]*handler.PoolSnapshot, 0)
+	if err := json.Unmarshal([]byte(data), &snapshots); err != nil {
+		return &resourcepb.Reply{Ready: false}, errors.Wrap(err, "invalid snapshots")
 	}
+	for _, s := range snapshots {
+		if err := r.handler.Permit(ctx, req.GetNamespace(), strings.Join([]string{s.Namespace, s.Name}, ".")); err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+	}
+	r.log.Debug("resource import", "snapshots", len(snapshots))
 
-	return &resourcepb.Reply{Ready: true}, nil
+	if err := r.handler.Import(ctx, snapshots); err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+
+	imported := 0
+	for _, s := range snapshots {
+		imported += len(s.Entries)
+	}
+	return &resourcepb.Reply{
+		Ready:     true,
+		Timestamp: time.Now().UnixNano(),
+		Data: map[string]*resourcepb.TypedValue{
+			"imported": {Value: &resourcepb.TypedValue_StringVal{StringVal: strconv.Itoa(imported)}},
+		},
+	}, nil
+}
+
+func (r *server) resourceCheck(ctx context.Context, crNames []string, opts handler.CheckOptions) (*resourcepb.Reply, error) {
+	r.log.Debug("resource check", "crNames", crNames, "repair", opts.Repair, "releaseOrphans", opts.ReleaseOrphans)
+	reports := make([]*handler.CheckReport, 0, len(crNames))
+	for _, crName := range crNames {
+		report, err := r.handler.Check(ctx, crName, opts)
+		if err != nil {
+			return &resourcepb.Reply{Ready: false}, err
+		}
+		reports = append(reports, report...)
+	}
+	data, err := json.Marshal(reports)
+	if err != nil {
+		return &resourcepb.Reply{Ready: false}, err
+	}
+	return &resourcepb.Reply{
+		Ready:     true,
+		Timestamp: time.Now().UnixNano(),
+		Data: map[string]*resourcepb.TypedValue{
+			"reports": {Value: &resourcepb.TypedValue_StringVal{StringVal: string(data)}},
+		},
+	}, nil
 }
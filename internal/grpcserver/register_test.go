@@ -0,0 +1,225 @@
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/handler"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestRegistry returns a ready registry which allows the namespaces
+func newTestRegistry(namespace, name string, allowed ...string) *niv1alpha1.Registry {
+	rg := &niv1alpha1.Registry{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: niv1alpha1.RegistrySpec{
+			Registry: &niv1alpha1.RegistryRegistry{Size: utils.Uint32Ptr(16)},
+		},
+	}
+	for _, ns := range allowed {
+		rg.Spec.Registry.AllowedNamespaces = append(rg.Spec.Registry.AllowedNamespaces, utils.StringPtr(ns))
+	}
+	rg.SetConditions(niv1alpha1.Ready())
+	return rg
+}
+
+// newTestServer returns a server with a handler backed by a fake client with
+// the registries default/rg1, which allows the namespace team1, and other/rg2
+// each with an allocation
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add core scheme: %v", err)
+	}
+	if err := niv1alpha1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add ni scheme: %v", err)
+	}
+	rgs := []client.Object{newTestRegistry("default", "rg1", "team1"), newTestRegistry("other", "rg2")}
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(rgs...).Build()
+	h, err := handler.New(handler.WithLogger(logging.NewNopLogger()), handler.WithClient(c))
+	if err != nil {
+		t.Fatalf("cannot create handler: %v", err)
+	}
+	srv := &server{log: logging.NewNopLogger(), handler: h}
+	for _, rg := range rgs {
+		if err := h.Init(context.Background(), rg.GetNamespace()+"."+rg.GetName(), 16); err != nil {
+			t.Fatalf("cannot init pool: %v", err)
+		}
+		if _, err := srv.ResourceRequest(context.Background(), &resourcepb.Request{
+			Namespace:    rg.GetNamespace(),
+			RegistryName: rg.GetName(),
+			Name:         "grpc1",
+			Request: &resourcepb.Req{
+				Selector:  map[string]string{"name": "blue"},
+				SourceTag: map[string]string{"node": "leaf7"},
+			},
+		}); err != nil {
+			t.Fatalf("cannot allocate: %v", err)
+		}
+	}
+	return srv
+}
+
+func TestResourceGetAllowList(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	// a query of all registries only reads the permitted registries
+	reply, err := srv.ResourceGet(ctx, &resourcepb.Request{
+		Namespace: "team1",
+		Request:   &resourcepb.Req{Selector: map[string]string{selectorKeySourceTagSelector: ""}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := make(map[string][]*hash.Entry)
+	if err := json.Unmarshal([]byte(reply.GetData()["entries"].GetStringVal()), &result); err != nil {
+		t.Fatalf("cannot decode entries: %v", err)
+	}
+	if len(result) != 1 || len(result["default.rg1"]) != 1 {
+		t.Errorf("only default.rg1 should be queried: %v", result)
+	}
+
+	// an export of all registries only reads the permitted registries
+	reply, err = srv.ResourceGet(ctx, &resourcepb.Request{
+		Namespace: "other",
+		Request:   &resourcepb.Req{Selector: map[string]string{selectorKeyExport: ""}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	snapshots := make([]*handler.PoolSnapshot, 0)
+	if err := json.Unmarshal([]byte(reply.GetData()["snapshots"].GetStringVal()), &snapshots); err != nil {
+		t.Fatalf("cannot decode snapshots: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Namespace != "other" {
+		t.Errorf("only other.rg2 should be exported: %v", snapshots)
+	}
+
+	// a registry in another namespace which does not allow the namespace
+	for _, sel := range []map[string]string{
+		{selectorKeyIndex: "0", selectorKeyRegistryNamespace: "other"},
+		{selectorKeyCheck: "", selectorKeyRegistryNamespace: "other"},
+	} {
+		if _, err := srv.ResourceGet(ctx, &resourcepb.Request{
+			Namespace:    "team1",
+			RegistryName: "rg2",
+			Request:      &resourcepb.Req{Selector: sel},
+		}); err == nil {
+			t.Errorf("the registry should not permit the namespace: %v", sel)
+		}
+	}
+
+	// a request without namespace
+	if _, err := srv.ResourceGet(ctx, &resourcepb.Request{
+		Request: &resourcepb.Req{Selector: map[string]string{selectorKeyExport: ""}},
+	}); err == nil {
+		t.Errorf("a request without namespace should be refused")
+	}
+}
+
+func TestResourceImportAllowList(t *testing.T) {
+	srv := newTestServer(t)
+	data, err := json.Marshal([]*handler.PoolSnapshot{{Namespace: "other", Name: "rg2", Size: 16}})
+	if err != nil {
+		t.Fatalf("cannot encode snapshots: %v", err)
+	}
+	if _, err := srv.ResourceRequest(context.Background(), &resourcepb.Request{
+		Namespace: "team1",
+		Request:   &resourcepb.Req{Selector: map[string]string{selectorKeyImport: string(data)}},
+	}); err == nil {
+		t.Errorf("an import into a registry which does not permit the namespace should be refused")
+	}
+}
+
+func TestResourceReleaseBySelectorAllowList(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	// a namespace the registry does not permit cannot release its registrations
+	if _, err := srv.ResourceRelease(ctx, &resourcepb.Request{
+		Namespace:    "team1",
+		RegistryName: "rg2",
+		Request: &resourcepb.Req{Selector: map[string]string{
+			selectorKeySourceTagSelector: "node=leaf7",
+			selectorKeyRegistryNamespace: "other",
+		}},
+	}); err == nil {
+		t.Errorf("the registry should not permit the namespace")
+	}
+	if allocated, _ := srv.handler.GetAllocated("other.rg2"); allocated != 1 {
+		t.Errorf("the registration should not be released, got %d allocations", allocated)
+	}
+}
+
+func TestResourceReleaseBySelectorPermitted(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	// the allow-list of default/rg1 permits team1
+	if _, err := srv.ResourceRelease(ctx, &resourcepb.Request{
+		Namespace:    "team1",
+		RegistryName: "rg1",
+		Request: &resourcepb.Req{Selector: map[string]string{
+			selectorKeySourceTagSelector: "node=leaf7",
+			selectorKeyRegistryNamespace: "default",
+		}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if allocated, _ := srv.handler.GetAllocated("default.rg1"); allocated != 0 {
+		t.Errorf("the registration should be released, got %d allocations", allocated)
+	}
+	if allocated, _ := srv.handler.GetAllocated("other.rg2"); allocated != 1 {
+		t.Errorf("the other registry should not change, got %d allocations", allocated)
+	}
+}
+
+func TestResourceCheckModes(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+	req := func(mode string) *resourcepb.Request {
+		return &resourcepb.Request{
+			Namespace:    "default",
+			RegistryName: "rg1",
+			Request:      &resourcepb.Req{Selector: map[string]string{selectorKeyCheck: mode}},
+		}
+	}
+
+	if _, err := srv.ResourceGet(ctx, req("")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// a get does not change the pools
+	for _, mode := range []string{checkModeRepair, checkModeReleaseOrphans} {
+		if _, err := srv.ResourceGet(ctx, req(mode)); err == nil {
+			t.Errorf("a get should refuse the check mode %s", mode)
+		}
+	}
+	if allocated, _ := srv.handler.GetAllocated("default.rg1"); allocated != 1 {
+		t.Errorf("the orphan should not be released by a get, got %d allocations", allocated)
+	}
+
+	if _, err := srv.ResourceRequest(ctx, req(checkModeRepair)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := srv.ResourceRequest(ctx, req(checkModeReleaseOrphans)); err == nil {
+		t.Errorf("a request should refuse to release the orphans")
+	}
+	if _, err := srv.ResourceRelease(ctx, req(checkModeReleaseOrphans)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if allocated, _ := srv.handler.GetAllocated("default.rg1"); allocated != 0 {
+		t.Errorf("the orphan should be released, got %d allocations", allocated)
+	}
+}
@@ -19,12 +19,19 @@ package grpcserver
 import (
 	"context"
 	"net"
+	"net/http"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/nddo-grpc/resource/resourcepb"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 )
@@ -34,6 +41,7 @@ const (
 	errStartGRPCServer   = "cannot start GRPC server"
 	errCreateTcpListener = "cannot create TCP listener"
 	errGrpcServer        = "cannot serve GRPC server"
+	errNotServing        = "GRPC server not serving"
 )
 
 type server struct {
@@ -55,6 +63,11 @@ type server struct {
 
 	// context
 	ctx context.Context
+
+	// servingMutex protects serving, which is true while the grpc server
+	// accepts connections
+	servingMutex sync.Mutex
+	serving      bool
 }
 
 func New(opts ...Option) (Server, error) {
@@ -93,31 +106,31 @@ func (s *server) WithHandler(h handler.Handler) {
 	s.handler = h
 }
 
+// Run listens on the address of the config and serves the grpc api until the
+// context is done, an error to listen is returned to the caller
 func (s *server) Run(ctx context.Context) error {
 	log := s.log.WithValues("grpcServerAddress", s.cfg.Address)
 	log.Debug("grpc server run...")
 	s.ctx = ctx
-	errChannel := make(chan error)
+
+	// create a listener on a specific address:port
+	l, err := net.Listen("tcp", s.cfg.Address)
+	if err != nil {
+		return errors.Wrap(err, errCreateTcpListener)
+	}
 	go func() {
-		if err := s.start(); err != nil {
-			errChannel <- errors.Wrap(err, errStartGRPCServer)
+		if err := s.start(ctx, l); err != nil {
+			log.Debug(errStartGRPCServer, "error", err)
 		}
-		errChannel <- nil
 	}()
 	return nil
 }
 
-// Start GRPC Server
-func (s *server) start() error {
+// Start GRPC Server on the listener, the server stops when the context is done
+func (s *server) start(ctx context.Context, l net.Listener) error {
 	log := s.log.WithValues("grpcServerAddress", s.cfg.Address)
 	log.Debug("grpc server start...")
 
-	// create a listener on a specific address:port
-	l, err := net.Listen("tcp", s.cfg.Address)
-	if err != nil {
-		return errors.Wrap(err, errCreateTcpListener)
-	}
-
 	// TODO, proper handling of the certificates with CERT Manager
 	/*
 		opts, err := s.serverOpts()
@@ -125,17 +138,65 @@ func (s *server) start() error {
 			return err
 		}
 	*/
-	// create a gRPC server object
-	grpcServer := grpc.NewServer()
+	// create a gRPC server object, the otel interceptors continue the trace of
+	// the client and pass the span context to the handler
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(otelgrpc.UnaryServerInterceptor(), auditOrigin),
+		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()),
+	)
 
 	// attach the gRPC service to the server
 	resourcepb.RegisterResourceServer(grpcServer, s)
 
+	// attach the standard health service, reporting every registered service
+	// and the server as a whole as serving
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	for name := range grpcServer.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+
+	go func() {
+		<-ctx.Done()
+		grpcServer.GracefulStop()
+	}()
+
 	// start the server
 	log.Debug("grpc server serve...")
+	s.setServing(true)
+	defer s.setServing(false)
 	if err := grpcServer.Serve(l); err != nil {
+		healthServer.Shutdown()
 		s.log.Debug("Errors", "error", err)
 		return errors.Wrap(err, errGrpcServer)
 	}
 	return nil
 }
+
+// auditOrigin marks the pool mutations of a request as requested through grpc
+// by the address of the client
+func auditOrigin(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+	origin := audit.Origin{Path: audit.PathGrpc}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		origin.Peer = p.Addr.String()
+	}
+	return next(audit.WithOrigin(ctx, origin), req)
+}
+
+func (s *server) setServing(serving bool) {
+	s.servingMutex.Lock()
+	defer s.servingMutex.Unlock()
+	s.serving = serving
+}
+
+// Ready returns an error when the grpc server does not accept connections, it
+// can be used as readiness check
+func (s *server) Ready(_ *http.Request) error {
+	s.servingMutex.Lock()
+	defer s.servingMutex.Unlock()
+	if !s.serving {
+		return errors.New(errNotServing)
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ package grpcserver
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
@@ -92,4 +93,5 @@ type Server interface {
 	//WithNewResourceFn(f func() niv1alpha1.Rg)
 	WithHandler(handler.Handler)
 	Run(ctx context.Context) error
+	Ready(*http.Request) error
 }
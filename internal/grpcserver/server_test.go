@@ -0,0 +1,30 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+)
+
+func TestRunListenError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	defer l.Close()
+
+	// the address is in use
+	s := &server{log: logging.NewNopLogger(), cfg: Config{Address: l.Addr().String()}}
+	if err := s.Run(context.Background()); err == nil {
+		t.Errorf("a listen error should be returned")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s = &server{log: logging.NewNopLogger(), cfg: Config{Address: "127.0.0.1:0"}}
+	if err := s.Run(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+)
+
+// recordAudit appends a mutation of the pool to the audit log, with the path
+// and peer of the origin carried by the context. A failure to record is logged
+// and does not fail the mutation, which already happened in the pool.
+func (r *handler) recordAudit(ctx context.Context, action, crName, niName string, index uint32, registrant string, sourceTag map[string]string) {
+	// crName is <namespace>.<name>, a namespace cannot contain a dot
+	split := strings.SplitN(crName, ".", 2)
+	if len(split) != 2 {
+		split = []string{"", crName}
+	}
+	origin := audit.OriginFrom(ctx)
+	if err := r.auditor.Record(&audit.Entry{
+		Action:     action,
+		Namespace:  split[0],
+		Registry:   split[1],
+		Name:       niName,
+		Index:      index,
+		Registrant: registrant,
+		SourceTag:  sourceTag,
+		Path:       origin.Path,
+		Peer:       origin.Peer,
+	}); err != nil {
+		r.log.Info("cannot record audit entry", "error", err, "action", action, "crName", crName, "niName", niName, "registrant", registrant)
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+)
+
+// testAuditor records the entries
+type testAuditor struct {
+	entries []*audit.Entry
+}
+
+func (a *testAuditor) Record(e *audit.Entry) error {
+	a.entries = append(a.entries, e)
+	return nil
+}
+
+func (a *testAuditor) Close() error { return nil }
+
+func TestAuditInsert(t *testing.T) {
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+	a := &testAuditor{}
+	h.WithAuditor(a)
+
+	testRegister(t, h, "grpc1", "blue", map[string]string{"node": "leaf1"})
+	// an unchanged registration does not change the pool
+	testRegister(t, h, "grpc1", "blue", map[string]string{"node": "leaf1"})
+	// a changed source tag does
+	testRegister(t, h, "grpc1", "blue", map[string]string{"node": "leaf2"})
+
+	if len(a.entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(a.entries))
+	}
+	if a.entries[0].Action != audit.ActionAllocate || a.entries[1].Action != audit.ActionUpdate || a.entries[1].SourceTag["node"] != "leaf2" {
+		t.Errorf("unexpected audit entries: %v %v", a.entries[0], a.entries[1])
+	}
+}
+
+func TestAuditCheckOrigin(t *testing.T) {
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+	testRegister(t, h, "grpc1", "blue", nil)
+	a := &testAuditor{}
+	h.WithAuditor(a)
+
+	ctx := audit.WithOrigin(context.Background(), audit.Origin{Path: audit.PathGrpc, Peer: "10.0.0.1:1234"})
+	if _, err := h.Check(ctx, "default.rg1", CheckOptions{Repair: true, ReleaseOrphans: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(a.entries) != 1 {
+		t.Fatalf("expected the release of the orphan, got %d entries", len(a.entries))
+	}
+	if e := a.entries[0]; e.Action != audit.ActionRelease || e.Path != audit.PathCheck || e.Peer != "10.0.0.1:1234" {
+		t.Errorf("the repair should be audited as check: %v", e)
+	}
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Kinds of check findings
+const (
+	// FindingOrphan is a registration in the pool without a Register CR, e.g.
+	// a grpc allocation or a leaked registration of a deleted register
+	FindingOrphan = "orphan"
+	// FindingMissing is a Register CR with an index whose registration is not in the pool
+	FindingMissing = "missing"
+	// FindingIndexMismatch is a Register CR whose recorded index differs from the pool
+	FindingIndexMismatch = "index-mismatch"
+	// FindingDuplicateIndex is an index claimed by registers of different ni
+	// names, or an ni name stored at multiple indices of the pool
+	FindingDuplicateIndex = "duplicate-index"
+
+	// event reasons
+	ReasonInconsistent event.Reason = "Inconsistent"
+)
+
+// CheckOptions control the consistency check of the pools
+type CheckOptions struct {
+	// Repair inserts the missing registrations and corrects the recorded index
+	// of the registers
+	Repair bool
+	// ReleaseOrphans releases the registrations without Register CR when
+	// repairing, this includes the grpc allocations
+	ReleaseOrphans bool
+}
+
+// CheckFinding is an inconsistency between the pool and the Register CRs
+type CheckFinding struct {
+	Kind       string `json:"kind"`
+	Registrant string `json:"registrant,omitempty"`
+	Name       string `json:"name"`
+	Index      uint32 `json:"index"`
+	Message    string `json:"message"`
+	Repaired   bool   `json:"repaired,omitempty"`
+}
+
+// CheckReport is the result of the consistency check of the pool of a registry
+type CheckReport struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Findings  []*CheckFinding `json:"findings"`
+}
+
+// Inconsistencies returns the amount of findings which are not orphans
+func (c *CheckReport) Inconsistencies() int {
+	n := 0
+	for _, f := range c.Findings {
+		if f.Kind != FindingOrphan {
+			n++
+		}
+	}
+	return n
+}
+
+// Check verifies the consistency between the pools and the Register CRs
+// targeting them, an empty crName checks all pools
+func (r *handler) Check(ctx context.Context, crName string, opts CheckOptions) ([]*CheckReport, error) {
+	// the repairs are audited as checks, with the peer which requested them
+	ctx = audit.WithOrigin(ctx, audit.Origin{Path: audit.PathCheck, Peer: audit.OriginFrom(ctx).Peer})
+	r.poolMutex.Lock()
+	crNames := make([]string, 0, len(r.pool))
+	if crName != "" {
+		if _, ok := r.pool[crName]; !ok {
+			r.poolMutex.Unlock()
+			return nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+		}
+		crNames = append(crNames, crName)
+	} else {
+		for name := range r.pool {
+			crNames = append(crNames, name)
+		}
+	}
+	r.poolMutex.Unlock()
+	sort.Strings(crNames)
+
+	rrl := r.newRegisterList()
+	if err := r.client.List(ctx, rrl); err != nil {
+		return nil, errors.Wrap(err, "cannot list registers")
+	}
+
+	reports := make([]*CheckReport, 0, len(crNames))
+	for _, name := range crNames {
+		report, err := r.check(ctx, name, rrl.GetRegisters(), opts)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// poolRegistration is the location of a registration in the pool
+type poolRegistration struct {
+	index uint32
+	key   string
+}
+
+func (r *handler) check(ctx context.Context, crName string, rrs []niv1alpha1.Rr, opts CheckOptions) (*CheckReport, error) {
+	// crName is <namespace>.<name>, a namespace cannot contain a dot
+	split := strings.SplitN(crName, ".", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("invalid crName %s", crName)
+	}
+	report := &CheckReport{
+		Namespace: split[0],
+		Name:      split[1],
+		Findings:  make([]*CheckFinding, 0),
+	}
+
+	// the registers targeting the registry by registrant
+	registers := make(map[string]niv1alpha1.Rr)
+	for _, rr := range rrs {
+		if !registerTargets(rr, crName) {
+			continue
+		}
+		info := &RegisterInfo{
+			Namespace:          rr.GetRegistryNamespace(),
+			RequesterNamespace: rr.GetNamespace(),
+			Name:               rr.GetName(),
+		}
+		registers[info.registrant()] = rr
+	}
+
+	unlock := r.lockPool(crName)
+	defer unlock()
+	r.poolMutex.Lock()
+	pool, ok := r.pool[crName]
+	if !ok {
+		r.poolMutex.Unlock()
+		return nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+	}
+
+	registrations := make(map[string]poolRegistration)
+	indices := make(map[string][]uint32)
+	for _, e := range pool.Query(labels.Everything()) {
+		indices[e.Key] = append(indices[e.Key], e.Index)
+		for name := range e.Register {
+			registrations[name] = poolRegistration{index: e.Index, key: e.Key}
+		}
+	}
+	for key, idxs := range indices {
+		if len(idxs) > 1 {
+			report.Findings = append(report.Findings, &CheckFinding{
+				Kind:    FindingDuplicateIndex,
+				Name:    key,
+				Index:   idxs[0],
+				Message: fmt.Sprintf("ni %s is stored at indices %v", key, idxs),
+			})
+		}
+	}
+
+	changes := make([]change, 0)
+	claims := make(map[uint32]string)
+	statusUpdates := make(map[string]uint32)
+	registrants := make([]string, 0, len(registers))
+	for registrant := range registers {
+		registrants = append(registrants, registrant)
+	}
+	sort.Strings(registrants)
+	for _, registrant := range registrants {
+		rr := registers[registrant]
+		if rr.GetDeletionTimestamp() != nil {
+			// a terminating register releases its registration, repairing it
+			// would allocate the ni again
+			continue
+		}
+		key := rr.GetSelector()["name"]
+		recorded, hasIndex := rr.HasNi()
+		if hasIndex {
+			if claim, ok := claims[recorded]; ok && claim != key {
+				report.Findings = append(report.Findings, &CheckFinding{
+					Kind:       FindingDuplicateIndex,
+					Registrant: registrant,
+					Name:       key,
+					Index:      recorded,
+					Message:    fmt.Sprintf("index %d is claimed by registers of ni %s and %s", recorded, claim, key),
+				})
+			}
+			claims[recorded] = key
+		}
+
+		p, ok := registrations[registrant]
+		switch {
+		case !ok && hasIndex:
+			f := &CheckFinding{
+				Kind:       FindingMissing,
+				Registrant: registrant,
+				Name:       key,
+				Index:      recorded,
+				Message:    fmt.Sprintf("register records index %d, but is not registered in the pool", recorded),
+			}
+			if opts.Repair && key != "" {
+				if idx, _, ok := pool.Probe(key); ok {
+					changes = append(changes, before(pool, idx, key, registrant))
+					index := pool.Insert(key, registrant, rr.GetSourceTag())
+					f.Repaired = true
+					if index != recorded {
+						statusUpdates[registrant] = index
+					}
+				}
+			}
+			report.Findings = append(report.Findings, f)
+		case ok && hasIndex && p.index != recorded:
+			f := &CheckFinding{
+				Kind:       FindingIndexMismatch,
+				Registrant: registrant,
+				Name:       p.key,
+				Index:      recorded,
+				Message:    fmt.Sprintf("register records index %d, the pool holds index %d", recorded, p.index),
+			}
+			if opts.Repair {
+				statusUpdates[registrant] = p.index
+				f.Repaired = true
+			}
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	orphans := make([]string, 0)
+	for registrant := range registrations {
+		if _, ok := registers[registrant]; !ok {
+			orphans = append(orphans, registrant)
+		}
+	}
+	sort.Strings(orphans)
+	for _, registrant := range orphans {
+		p := registrations[registrant]
+		f := &CheckFinding{
+			Kind:       FindingOrphan,
+			Registrant: registrant,
+			Name:       p.key,
+			Index:      p.index,
+			Message:    "registration without register, e.g. a grpc allocation",
+		}
+		if opts.Repair && opts.ReleaseOrphans {
+			changes = append(changes, before(pool, p.index, p.key, registrant))
+			pool.Delete(p.key, registrant, nil)
+			f.Repaired = true
+		}
+		report.Findings = append(report.Findings, f)
+	}
+
+	if len(changes) == 0 {
+		r.poolMutex.Unlock()
+	} else {
+		u := r.snapshot(crName, pool, changes)
+		r.poolMutex.Unlock()
+		err := r.persist(ctx, crName, pool, u, changes)
+		r.notify(ctx, crName)
+		if err != nil {
+			return report, err
+		}
+		for _, c := range changes {
+			if c.registered {
+				r.recordAudit(ctx, audit.ActionRelease, crName, c.key, c.index, c.registrant, c.labels)
+			} else {
+				r.recordAudit(ctx, audit.ActionAllocate, crName, c.key, c.index, c.registrant, registers[c.registrant].GetSourceTag())
+			}
+		}
+	}
+
+	// correct the index recorded in the status of the registers
+	for registrant, index := range statusUpdates {
+		rr := registers[registrant]
+		rr.SetNi(index)
+		if err := r.client.Status().Update(ctx, rr); err != nil {
+			return report, errors.Wrapf(err, "cannot update the index of register %s", registrant)
+		}
+	}
+
+	// an orphan is expected for every grpc allocation, so orphans alone do not
+	// raise the inconsistent event
+	if n := report.Inconsistencies(); n > 0 {
+		r.log.Debug("pool inconsistent", "crName", crName, "findings", len(report.Findings))
+		registry := r.newRegistry()
+		if err := r.client.Get(ctx, types.NamespacedName{Namespace: report.Namespace, Name: report.Name}, registry); err == nil {
+			r.record.Event(registry, event.Warning(ReasonInconsistent,
+				fmt.Errorf("%d inconsistencies between the pool and the registers", n)))
+		}
+	}
+	return report, nil
+}
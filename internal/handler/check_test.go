@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yndd/ndd-runtime/pkg/event"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testRecorder records the events
+type testRecorder struct {
+	events []event.Event
+}
+
+func (r *testRecorder) Event(_ runtime.Object, e event.Event) {
+	r.events = append(r.events, e)
+}
+
+func (r *testRecorder) WithAnnotations(_ ...string) event.Recorder {
+	return r
+}
+
+func TestCheckOrphansOnly(t *testing.T) {
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+	testRegister(t, h, "grpc1", "blue", nil)
+	rec := &testRecorder{}
+	h.WithRecorder(rec)
+
+	reports, err := h.Check(context.Background(), "default.rg1", CheckOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reports) != 1 || len(reports[0].Findings) != 1 || reports[0].Findings[0].Kind != FindingOrphan {
+		t.Fatalf("expected an orphan finding: %#v", reports)
+	}
+	if reports[0].Inconsistencies() != 0 || len(rec.events) != 0 {
+		t.Errorf("a grpc allocation should not raise the inconsistent event: %v", rec.events)
+	}
+}
+
+func TestCheckTerminatingRegister(t *testing.T) {
+	now := metav1.NewTime(time.Now())
+	terminating := newTestRegister("default", "reg1", "rg1", "blue", nil)
+	terminating.SetDeletionTimestamp(&now)
+	terminating.SetFinalizers([]string{"test"})
+	terminating.SetNi(3)
+	missing := newTestRegister("default", "reg2", "rg1", "red", nil)
+	missing.SetNi(5)
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16), terminating, missing)
+	rec := &testRecorder{}
+	h.WithRecorder(rec)
+
+	reports, err := h.Check(context.Background(), "default.rg1", CheckOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	findings := reports[0].Findings
+	if len(findings) != 1 || findings[0].Registrant != "reg2" || findings[0].Kind != FindingMissing || !findings[0].Repaired {
+		t.Fatalf("only the missing registration of reg2 should be found: %#v", findings)
+	}
+	entries, err := h.Query("default.rg1", "")
+	if err != nil || len(entries["default.rg1"]) != 1 || entries["default.rg1"][0].Key != "red" {
+		t.Errorf("the terminating register should not be repaired: %#v %v", entries, err)
+	}
+	if len(rec.events) != 1 {
+		t.Errorf("expected the inconsistent event, got %v", rec.events)
+	}
+}
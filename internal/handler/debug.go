@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PoolDebug is the live state of the pool of a registry
+type PoolDebug struct {
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Stats     hash.Stats `json:"stats"`
+	// PendingSince is the time of the first pool change which did not yet
+	// trigger a status refresh of the registry
+	PendingSince *time.Time    `json:"pending-since,omitempty"`
+	Slots        []*hash.Entry `json:"slots"`
+}
+
+// Debug returns the live state of the pools sorted by crName, an empty crName
+// returns all pools
+func (r *handler) Debug(crName string) []*PoolDebug {
+	pending := make(map[string]time.Time)
+	if r.trigger != nil {
+		pending = r.trigger.Pending()
+	}
+
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	crNames := make([]string, 0, len(r.pool))
+	for name := range r.pool {
+		if crName == "" || crName == name {
+			crNames = append(crNames, name)
+		}
+	}
+	sort.Strings(crNames)
+
+	pools := make([]*PoolDebug, 0, len(crNames))
+	for _, name := range crNames {
+		// crName is <namespace>.<name>, a namespace cannot contain a dot
+		split := strings.SplitN(name, ".", 2)
+		if len(split) != 2 {
+			continue
+		}
+		pool := r.pool[name]
+		d := &PoolDebug{
+			Namespace: split[0],
+			Name:      split[1],
+			Stats:     pool.Stats(),
+			Slots:     pool.Query(labels.Everything()),
+		}
+		if first, ok := pending[name]; ok {
+			d.PendingSince = &first
+		}
+		pools = append(pools, d)
+	}
+	return pools
+}
@@ -3,23 +3,44 @@ package handler
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
 	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	"github.com/yndd/nddr-ni-registry/internal/trigger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func New(opts ...Option) (Handler, error) {
 	rgfn := func() niv1alpha1.Rg { return &niv1alpha1.Registry{} }
+	rglfn := func() niv1alpha1.RgList { return &niv1alpha1.RegistryList{} }
+	rrlfn := func() niv1alpha1.RrList { return &niv1alpha1.RegisterList{} }
 	s := &handler{
-		pool:        make(map[string]hash.HashTable),
-		speedy:      make(map[string]int),
-		newRegistry: rgfn,
+		pool:            make(map[string]hash.HashTable),
+		revision:        make(map[string]uint64),
+		poolLocks:       make(map[string]*sync.Mutex),
+		unsaved:         make(map[string]bool),
+		newRegistry:     rgfn,
+		newRegistryList: rglfn,
+		newRegisterList: rrlfn,
+		record:          event.NewNopRecorder(),
+		store:           store.NewMemory(),
+		auditor:         audit.NewNop(),
 	}
 
 	for _, opt := range opts {
@@ -41,17 +62,88 @@ func (r *handler) WithClient(c client.Client) {
 	r.client = c
 }
 
+func (r *handler) WithRecorder(rec event.Recorder) {
+	r.record = rec
+}
+
+func (r *handler) WithStore(s store.Store) {
+	r.store = s
+}
+
+func (r *handler) WithAuditor(a audit.Auditor) {
+	r.auditor = a
+}
+
+func (r *handler) WithTrigger(t trigger.Trigger) {
+	r.trigger = t
+}
+
 //func (r *handler) WithNewResourceFn(f func() niv1alpha1.Rg) {
 //	r.newRegistry = f
 //}
 
 type RegisterInfo struct {
-	Namespace    string
-	Name         string
-	RegistryName string
-	CrName       string
-	Selector     map[string]string
-	SourceTag    map[string]string
+	// Namespace of the registry
+	Namespace string
+	// RequesterNamespace is the namespace of the register or grpc client, it
+	// defaults to the namespace of the registry
+	RequesterNamespace string
+	Name               string
+	RegistryName       string
+	CrName             string
+	Selector           map[string]string
+	SourceTag          map[string]string
+}
+
+// registrant returns the name of the registration in the pool, a registration
+// from another namespace is prefixed with its namespace to avoid name clashes
+func (info *RegisterInfo) registrant() string {
+	if info.RequesterNamespace == "" || info.RequesterNamespace == info.Namespace {
+		return info.Name
+	}
+	return info.RequesterNamespace + "/" + info.Name
+}
+
+// registrantNamespacedName returns the namespace and name of the register
+// owning a registration, see registrant
+func registrantNamespacedName(namespace, registrant string) types.NamespacedName {
+	if split := strings.SplitN(registrant, "/", 2); len(split) == 2 {
+		return types.NamespacedName{Namespace: split[0], Name: split[1]}
+	}
+	return types.NamespacedName{Namespace: namespace, Name: registrant}
+}
+
+const (
+	// collisionProbeWarning is the probe length from which an allocation emits
+	// a collision warning event
+	collisionProbeWarning = 8
+
+	// event reasons
+	ReasonAllocated event.Reason = "AllocatedIndex"
+	ReasonReleased  event.Reason = "ReleasedIndex"
+	ReasonExhausted event.Reason = "PoolExhausted"
+	ReasonCollision event.Reason = "HashCollision"
+	ReasonSelector  event.Reason = "InvalidSelector"
+)
+
+var (
+	// ErrPoolExhausted is returned when the pool has no free index left
+	ErrPoolExhausted = errors.New("pool exhausted")
+	// ErrInvalidSelector is returned when the selector of a registration is invalid
+	ErrInvalidSelector = errors.New("invalid selector")
+	// ErrPoolShrink is returned when the size of a registry is below an
+	// allocated index of its pool, the pool keeps its size
+	ErrPoolShrink = errors.New("pool cannot shrink below an allocated index")
+)
+
+// ReleaseResult reports the outcome of a bulk release
+type ReleaseResult struct {
+	// Freed are the ni names that no longer have registrants
+	Freed []string `json:"freed"`
+	// Retained are the ni names that still have other registrants
+	Retained []string `json:"retained"`
+	// Registrants are the names of the released registrations
+	Registrants []string `json:"registrants"`
 }
 
 type handler struct {
@@ -59,35 +151,157 @@ type handler struct {
 	// kubernetes
 	client client.Client
 
-	newRegistry func() niv1alpha1.Rg
-	poolMutex   sync.Mutex
-	pool        map[string]hash.HashTable
-	speedyMutex sync.Mutex
-	speedy      map[string]int
+	newRegistry     func() niv1alpha1.Rg
+	newRegistryList func() niv1alpha1.RgList
+	newRegisterList func() niv1alpha1.RrList
+	poolMutex       sync.Mutex
+	pool            map[string]hash.HashTable
+	// revisions counts the changes of all pools, revision holds the count at
+	// the last change per pool, so a recreated pool never repeats a revision
+	revisions uint64
+	revision  map[string]uint64
+	// poolLocks serialize the changes of a pool with their persistence
+	poolLocks map[string]*sync.Mutex
+	// unsaved marks the pools whose last persist failed, the next persist
+	// saves the complete pool
+	unsaved map[string]bool
+	// trigger is notified on every pool change to refresh the registry status
+	trigger trigger.Trigger
+	// record emits the allocation events on the registry
+	record event.Recorder
+	// store persists the entries of the pools
+	store store.Store
+	// auditor records every mutation of the pools
+	auditor audit.Auditor
+	// restored is true once the pools of all registries are restored from the store
+	restored bool
 }
 
-func (r *handler) Init(crName string, size uint32) {
+// Init initializes the pool of the registry, a new pool is restored from the
+// entries persisted in the store, an existing pool is resized to the size of
+// the registry. The allocations keep their index, so a pool does not shrink
+// below its highest allocated index, ErrPoolShrink is returned until the
+// indexes above the size are released.
+func (r *handler) Init(ctx context.Context, crName string, size uint32) error {
+	unlock := r.lockPool(crName)
+	defer unlock()
 	r.poolMutex.Lock()
 	defer r.poolMutex.Unlock()
-	if _, ok := r.pool[crName]; !ok {
-		r.pool[crName] = hash.New(size)
+	if pool, ok := r.pool[crName]; ok {
+		if pool.Size() == size {
+			return nil
+		}
+		entries := pool.Query(labels.Everything())
+		if last := lastIndex(entries); len(entries) > 0 && last >= size {
+			return errors.Wrapf(ErrPoolShrink, "cannot resize pool to %d, index %d is allocated, crName: %s", size, last, crName)
+		}
+		resized, err := newPool(size, entries)
+		if err != nil {
+			return errors.Wrapf(err, "cannot resize pool, crName: %s", crName)
+		}
+		r.log.Debug("pool resized", "crName", crName, "from", pool.Size(), "to", size)
+		r.pool[crName] = resized
+		r.changed(crName)
+		return nil
+	}
+	entries, err := r.store.Load(ctx, crName)
+	if err != nil {
+		return errors.Wrapf(err, "cannot load pool, crName: %s", crName)
+	}
+	// a pool persisted before the registry shrunk is restored with all its
+	// allocations, the next init refuses the shrink
+	restoreSize := size
+	if last := lastIndex(entries); len(entries) > 0 && last >= size {
+		restoreSize = last + 1
+	}
+	pool, err := newPool(restoreSize, entries)
+	if err != nil {
+		return errors.Wrapf(err, "cannot restore pool, crName: %s", crName)
 	}
+	r.log.Debug("pool initialized", "crName", crName, "restored", len(entries), "size", restoreSize)
+	r.pool[crName] = pool
+	r.changed(crName)
+	return nil
+}
+
+// newPool returns a pool of the size holding the entries at their index
+func newPool(size uint32, entries []*hash.Entry) (hash.HashTable, error) {
+	pool := hash.New(size)
+	for _, e := range entries {
+		if err := pool.Set(e); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
 
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; !ok {
-		r.speedy[crName] = 0
+// lastIndex returns the highest index of the entries, 0 without entries
+func lastIndex(entries []*hash.Entry) uint32 {
+	last := uint32(0)
+	for _, e := range entries {
+		if e.Index > last {
+			last = e.Index
+		}
 	}
+	return last
 }
 
-func (r *handler) Delete(crName string) {
+// Delete removes the pool of the registry and its persisted entries
+func (r *handler) Delete(ctx context.Context, crName string) error {
+	unlock := r.lockPool(crName)
+	defer unlock()
 	r.poolMutex.Lock()
-	defer r.poolMutex.Unlock()
 	delete(r.pool, crName)
+	delete(r.revision, crName)
+	delete(r.unsaved, crName)
+	r.poolMutex.Unlock()
+	return errors.Wrapf(r.store.Delete(ctx, crName), "cannot delete pool, crName: %s", crName)
+}
 
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	delete(r.speedy, crName)
+// Restore initializes the pools of all registries from the store, so
+// allocations are served with the persisted state before the registries are
+// reconciled
+func (r *handler) Restore(ctx context.Context) error {
+	rgl := r.newRegistryList()
+	if err := r.client.List(ctx, rgl); err != nil {
+		return errors.Wrap(err, "cannot list registries")
+	}
+	for _, rg := range rgl.GetRegistries() {
+		crName := strings.Join([]string{rg.GetNamespace(), rg.GetName()}, ".")
+		if err := r.Init(ctx, crName, rg.GetSize()); err != nil {
+			return err
+		}
+	}
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	r.restored = true
+	r.log.Debug("pools restored", "registries", len(rgl.GetRegistries()))
+	return nil
+}
+
+// Ready returns an error until the pools are restored, it can be used as
+// readiness check
+func (r *handler) Ready(_ *http.Request) error {
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	if !r.restored {
+		return errors.New("pools not restored")
+	}
+	return nil
+}
+
+// Revision returns the revision of the pool, it changes with every change of
+// the pool, a pool which is not initialized has revision 0
+func (r *handler) Revision(crName string) uint64 {
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	return r.revision[crName]
+}
+
+// changed bumps the revision of the pool, the caller holds the pool mutex
+func (r *handler) changed(crName string) {
+	r.revisions++
+	r.revision[crName] = r.revisions
 }
 
 func (r *handler) GetAllocated(crName string) (uint32, []*string) {
@@ -99,68 +313,314 @@ func (r *handler) GetAllocated(crName string) (uint32, []*string) {
 	return 0, make([]*string, 0)
 }
 
-func (r *handler) ResetSpeedy(crName string) {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		r.speedy[crName] = 0
+func (r *handler) GetByIndex(crName string, index uint32) (*hash.Entry, error) {
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	pool, ok := r.pool[crName]
+	if !ok {
+		return nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+	}
+	entry, ok := pool.GetByIndex(index)
+	if !ok {
+		return nil, fmt.Errorf("index %d not allocated, crName: %s", index, crName)
+	}
+	return entry, nil
+}
+
+// Query returns per pool the entries whose registrants match the label
+// selector, an empty crName queries all pools
+func (r *handler) Query(crName, selector string) (map[string][]*hash.Entry, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid selector")
 	}
+
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	result := make(map[string][]*hash.Entry)
+	if crName != "" {
+		pool, ok := r.pool[crName]
+		if !ok {
+			return nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+		}
+		result[crName] = pool.Query(s)
+		return result, nil
+	}
+	for name, pool := range r.pool {
+		if entries := pool.Query(s); len(entries) > 0 {
+			result[name] = entries
+		}
+	}
+	return result, nil
 }
 
-func (r *handler) GetSpeedy(crName string) int {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		return r.speedy[crName]
+// ReleaseBySelector releases every registration of the pool whose source tags
+// match the label selector. The Register CRs targeting the registry which own
+// the released registrations are deleted, so they don't allocate the ni again
+// on their next reconcile.
+func (r *handler) ReleaseBySelector(ctx context.Context, namespace, crName, selector string) (*ReleaseResult, error) {
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid selector")
+	}
+	if s.Empty() {
+		return nil, errors.New("an empty selector would release all registrations")
 	}
-	return 9999
+	return r.release(ctx, namespace, crName, s)
 }
 
-func (r *handler) IncrementSpeedy(crName string) {
-	r.speedyMutex.Lock()
-	defer r.speedyMutex.Unlock()
-	if _, ok := r.speedy[crName]; ok {
-		r.speedy[crName]++
+// ReleaseAll releases every registration of the pool and deletes the Register
+// CRs owning them, a pool which is not initialized has nothing to release.
+func (r *handler) ReleaseAll(ctx context.Context, namespace, crName string) (*ReleaseResult, error) {
+	r.poolMutex.Lock()
+	_, ok := r.pool[crName]
+	r.poolMutex.Unlock()
+	if !ok {
+		return &ReleaseResult{
+			Freed:       make([]string, 0),
+			Retained:    make([]string, 0),
+			Registrants: make([]string, 0),
+		}, nil
 	}
+	return r.release(ctx, namespace, crName, labels.Everything())
 }
 
-func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*uint32, error) {
-	pool, niName, err := r.validateRegister(ctx, info)
+func (r *handler) release(ctx context.Context, namespace, crName string, s labels.Selector) (*ReleaseResult, error) {
+	ctx, span := tracer.Start(ctx, "handler.Release", trace.WithAttributes(
+		attribute.String(attrCrName, crName),
+		attribute.String(attrSelector, s.String()),
+	))
+	defer span.End()
+
+	result := &ReleaseResult{
+		Freed:       make([]string, 0),
+		Retained:    make([]string, 0),
+		Registrants: make([]string, 0),
+	}
+
+	unlock := r.lockPool(crName)
+	r.poolMutex.Lock()
+	pool, ok := r.pool[crName]
+	if !ok {
+		r.poolMutex.Unlock()
+		unlock()
+		return nil, traceError(span, fmt.Errorf("pool/tree not ready, crName: %s", crName))
+	}
+	r.log.Debug("pool delete by selector", "crName", crName, "selector", s.String())
+	deleted := pool.DeleteBySelector(s)
+	for _, e := range deleted {
+		if _, ok := pool.GetByIndex(e.Index); ok {
+			result.Retained = append(result.Retained, e.Key)
+		} else {
+			result.Freed = append(result.Freed, e.Key)
+		}
+	}
+	changes := removed(deleted)
+	u := r.snapshot(crName, pool, changes)
+	r.poolMutex.Unlock()
+	err := r.persist(ctx, crName, pool, u, changes)
+	unlock()
+	r.notify(ctx, crName)
+	if err != nil {
+		return nil, traceError(span, err)
+	}
+	r.log.Debug("pool deleted by selector", "crName", crName, "freed", result.Freed, "retained", result.Retained)
+	for _, c := range changes {
+		result.Registrants = append(result.Registrants, c.registrant)
+		r.recordAudit(ctx, audit.ActionRelease, crName, c.key, c.index, c.registrant, c.labels)
+	}
+
+	for _, c := range changes {
+		if err := r.deleteOwningRegister(ctx, namespace, crName, c.registrant, c.key); err != nil {
+			return result, traceError(span, errors.Wrapf(err, "cannot delete register %s", c.registrant))
+		}
+	}
+
+	span.SetAttributes(attribute.Int(attrReleased, len(result.Registrants)))
+	return result, nil
+}
+
+// deleteOwningRegister deletes the Register CR owning a released registration,
+// so it does not allocate the ni again on its next reconcile. Only a Register
+// CR targeting the registry with the released ni name is deleted, a registrant
+// without such a CR, e.g. a grpc allocation, has nothing to delete.
+func (r *handler) deleteOwningRegister(ctx context.Context, namespace, crName, registrant, key string) error {
+	rr := &niv1alpha1.Register{}
+	if err := r.client.Get(ctx, registrantNamespacedName(namespace, registrant), rr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !registerTargets(rr, crName) || rr.GetSelector()["name"] != key {
+		r.log.Debug("register does not own the registration, skip delete", "registrant", registrant, "crName", crName, "niName", key)
+		return nil
+	}
+	return client.IgnoreNotFound(r.client.Delete(ctx, rr))
+}
+
+// registerTargets reports if the register allocates from the registry with
+// crName <namespace>.<name>, a register selecting its registry by oda targets
+// the registry it was last allocated from
+func registerTargets(rr niv1alpha1.Rr, crName string) bool {
+	registryName := rr.GetRegistryName()
+	if registryName == "" {
+		registryName = rr.GetStatusRegistryName()
+	}
+	return registryName != "" && strings.Join([]string{rr.GetRegistryNamespace(), registryName}, ".") == crName
+}
+
+// ResolveRegistry returns the name of the registry in the namespace whose oda
+// matches the organization, deployment and availability zone. An empty
+// deployment or availability zone matches any, the match must be unique.
+func (r *handler) ResolveRegistry(ctx context.Context, namespace, org, dep, az string) (string, error) {
+	if org == "" {
+		return "", errors.New("cannot resolve the registry without organization")
+	}
+	rgl := r.newRegistryList()
+	if err := r.client.List(ctx, rgl, client.InNamespace(namespace)); err != nil {
+		return "", errors.Wrap(err, "cannot list registries")
+	}
+
+	matches := make([]string, 0)
+	for _, rg := range rgl.GetRegistries() {
+		if rg.GetOrganization() != org {
+			continue
+		}
+		if dep != "" && rg.GetDeployment() != dep {
+			continue
+		}
+		if az != "" && rg.GetAvailabilityZone() != az {
+			continue
+		}
+		matches = append(matches, rg.GetName())
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no registry matches organization: %s, deployment: %s, availability-zone: %s", org, dep, az)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous registry match for organization: %s, deployment: %s, availability-zone: %s, registries: %v", org, dep, az, matches)
+	}
+}
+
+// notify signals a pool change to the trigger
+func (r *handler) notify(ctx context.Context, crName string) {
+	if r.trigger != nil {
+		r.trigger.Notify(ctx, crName)
+	}
+}
+
+func (r *handler) register(ctx context.Context, info *RegisterInfo) (*uint32, error) {
+	registry, pool, niName, err := r.validateRegister(ctx, info, true)
 	if err != nil {
 		return nil, err
 	}
-	requestName := info.Name
+	requestName := info.registrant()
 	sourceTag := info.SourceTag
 
+	unlock := r.lockPool(info.CrName)
+	defer unlock()
+	r.poolMutex.Lock()
+	idx, probe, ok := pool.Probe(*niName)
+	if !ok {
+		r.poolMutex.Unlock()
+		err := errors.Wrapf(ErrPoolExhausted, "cannot allocate ni %s for %s", *niName, requestName)
+		r.record.Event(registry, event.Warning(ReasonExhausted, err))
+		return nil, err
+	}
+	c := before(pool, idx, *niName, requestName)
+	allocated := c.registered
+
 	r.log.Debug("pool insert", "niName", niName)
 	index := pool.Insert(*niName, requestName, sourceTag)
 	r.log.Debug("pool inserted", "niName", niName, "index", index)
+	u := r.snapshot(info.CrName, pool, []change{c})
+	r.poolMutex.Unlock()
+	err = r.persist(ctx, info.CrName, pool, u, []change{c})
+	r.notify(ctx, info.CrName)
+	if err != nil {
+		return nil, err
+	}
+
+	// every insert which changes the pool is audited, an insert of an allocated
+	// registrant only changes its source tag
+	switch {
+	case !allocated:
+		r.recordAudit(ctx, audit.ActionAllocate, info.CrName, *niName, index, requestName, sourceTag)
+	case !labels.Equals(c.labels, labels.Set(sourceTag)):
+		r.recordAudit(ctx, audit.ActionUpdate, info.CrName, *niName, index, requestName, sourceTag)
+	}
+	if !allocated {
+		r.record.Event(registry, event.Normal(ReasonAllocated,
+			fmt.Sprintf("ni %s index %d allocated to %s", *niName, index, requestName)))
+		if probe >= collisionProbeWarning {
+			r.record.Event(registry, event.Warning(ReasonCollision,
+				fmt.Errorf("ni %s probed %d collisions before index %d", *niName, probe, index)))
+		}
+	}
 
 	return &index, nil
 }
 
-func (r *handler) DeRegister(ctx context.Context, info *RegisterInfo) error {
+func (r *handler) deRegister(ctx context.Context, info *RegisterInfo) error {
 
-	pool, niName, err := r.validateRegister(ctx, info)
+	registry, pool, niName, err := r.validateRegister(ctx, info, false)
 	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			// the registry and its pool are gone, e.g. with an orphan or cascade
+			// deletion policy, so there is nothing left to release
+			r.log.Debug("registry not found, nothing to release", "crName", info.CrName)
+			return nil
+		}
 		return err
 	}
-	requestName := info.Name
+	requestName := info.registrant()
 	sourceTag := info.SourceTag
 
+	unlock := r.lockPool(info.CrName)
+	defer unlock()
+	r.poolMutex.Lock()
+	index, _, _ := pool.Probe(*niName)
+	c := before(pool, index, *niName, requestName)
+	allocated := c.registered
+
 	r.log.Debug("pool delete", "niName", niName)
 	pool.Delete(*niName, requestName, sourceTag)
 	r.log.Debug("pool deleted", "niName", niName)
+	if !allocated {
+		// nothing changed, so there is nothing to persist
+		r.poolMutex.Unlock()
+		r.notify(ctx, info.CrName)
+		return nil
+	}
+	u := r.snapshot(info.CrName, pool, []change{c})
+	r.poolMutex.Unlock()
+	err = r.persist(ctx, info.CrName, pool, u, []change{c})
+	r.notify(ctx, info.CrName)
+	if err != nil {
+		return err
+	}
+
+	r.recordAudit(ctx, audit.ActionRelease, info.CrName, *niName, index, requestName, sourceTag)
+	r.record.Event(registry, event.Normal(ReasonReleased,
+		fmt.Sprintf("ni %s index %d released by %s", *niName, index, requestName)))
 
 	return nil
 }
 
-func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo) (hash.HashTable, *string, error) {
+// validateRegister returns the pool and ni name of the registration, only an
+// allocation requires the registry to be ready, a release is possible as long
+// as the pool exists, e.g. while the deletion of the registry is blocked
+func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo, allocate bool) (niv1alpha1.Rg, hash.HashTable, *string, error) {
 	namespace := info.Namespace
 	registryName := info.RegistryName
 	crName := info.CrName
 	selector := info.Selector
 
+	if registryName == "" {
+		return nil, nil, nil, errors.New("registry name not set, specify a registry-name or use an odns name")
+	}
+
 	// find registry in k8s api
 	registry := r.newRegistry()
 	if err := r.client.Get(ctx, types.NamespacedName{
@@ -168,18 +628,29 @@ func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo) (has
 		Name:      registryName}, registry); err != nil {
 		// can happen when the ipam is not found
 		r.log.Debug("registry not found")
-		return nil, nil, errors.Wrap(err, "registry not found")
+		return nil, nil, nil, errors.Wrap(err, "registry not found")
+	}
+
+	// check if the requester namespace may allocate from the registry
+	if err := r.validateNamespace(ctx, registry, info.RequesterNamespace); err != nil {
+		r.log.Debug("namespace not allowed", "namespace", info.RequesterNamespace)
+		return nil, nil, nil, err
+	}
+
+	// a registry being deleted does not accept new registrations
+	if allocate && registry.GetDeletionTimestamp() != nil {
+		return nil, nil, nil, fmt.Errorf("registry %s/%s is being deleted", namespace, registryName)
 	}
 
 	// check is registry is ready
-	if registry.GetCondition(niv1alpha1.ConditionKindReady).Status != corev1.ConditionTrue {
+	if allocate && registry.GetCondition(niv1alpha1.ConditionKindReady).Status != corev1.ConditionTrue {
 		r.log.Debug("Registry not ready")
-		return nil, nil, errors.New("Registry not ready")
+		return nil, nil, nil, errors.New("Registry not ready")
 	}
 
 	// check if the supplied info is available
 	if _, ok := selector["name"]; !ok {
-		return nil, nil, errors.New("selector does not contain a name")
+		return nil, nil, nil, errors.Wrap(ErrInvalidSelector, "selector does not contain a name")
 	}
 	niName := selector["name"]
 
@@ -188,9 +659,79 @@ func (r *handler) validateRegister(ctx context.Context, info *RegisterInfo) (has
 	defer r.poolMutex.Unlock()
 	if _, ok := r.pool[crName]; !ok {
 		r.log.Debug("pool/tree not ready", "crName", crName)
-		return nil, nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+		return nil, nil, nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
 	}
 	pool := r.pool[crName]
 
-	return pool, &niName, nil
+	return registry, pool, &niName, nil
+}
+
+// Permit checks if the requester namespace may access the pool of the registry
+// with crName <namespace>.<name>, following the allow-list of the registry.
+func (r *handler) Permit(ctx context.Context, namespace, crName string) error {
+	if namespace == "" {
+		return errors.New("requester namespace not set")
+	}
+	// crName is <namespace>.<name>, a namespace cannot contain a dot
+	split := strings.SplitN(crName, ".", 2)
+	if len(split) != 2 {
+		return fmt.Errorf("invalid crName %s", crName)
+	}
+	registry := r.newRegistry()
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: split[0], Name: split[1]}, registry); err != nil {
+		return errors.Wrap(err, "registry not found")
+	}
+	return r.validateNamespace(ctx, registry, namespace)
+}
+
+// Permitted returns the sorted crNames of the pools the requester namespace
+// may access, see Permit
+func (r *handler) Permitted(ctx context.Context, namespace string) ([]string, error) {
+	if namespace == "" {
+		return nil, errors.New("requester namespace not set")
+	}
+	r.poolMutex.Lock()
+	crNames := make([]string, 0, len(r.pool))
+	for crName := range r.pool {
+		crNames = append(crNames, crName)
+	}
+	r.poolMutex.Unlock()
+	sort.Strings(crNames)
+
+	permitted := make([]string, 0, len(crNames))
+	for _, crName := range crNames {
+		if err := r.Permit(ctx, namespace, crName); err != nil {
+			r.log.Debug("pool not permitted", "crName", crName, "namespace", namespace, "error", err)
+			continue
+		}
+		permitted = append(permitted, crName)
+	}
+	return permitted, nil
+}
+
+// validateNamespace checks if the namespace may allocate from the registry, the
+// namespace of the registry itself is always allowed
+func (r *handler) validateNamespace(ctx context.Context, registry niv1alpha1.Rg, namespace string) error {
+	if namespace == "" || namespace == registry.GetNamespace() {
+		return nil
+	}
+	for _, ns := range registry.GetAllowedNamespaces() {
+		if ns == namespace {
+			return nil
+		}
+	}
+	if ls := registry.GetAllowedNamespaceSelector(); ls != nil {
+		s, err := metav1.LabelSelectorAsSelector(ls)
+		if err != nil {
+			return errors.Wrap(err, "invalid allowed-namespace-selector")
+		}
+		ns := &corev1.Namespace{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return errors.Wrapf(err, "cannot get namespace %s", namespace)
+		}
+		if s.Matches(labels.Set(ns.GetLabels())) {
+			return nil
+		}
+	}
+	return fmt.Errorf("namespace %s is not allowed to allocate from registry %s/%s", namespace, registry.GetNamespace(), registry.GetName())
 }
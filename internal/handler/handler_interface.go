@@ -2,8 +2,14 @@ package handler
 
 import (
 	"context"
+	"net/http"
 
+	"github.com/yndd/ndd-runtime/pkg/event"
 	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	"github.com/yndd/nddr-ni-registry/internal/trigger"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -31,6 +37,34 @@ func WithClient(c client.Client) Option {
 	}
 }
 
+// WithRecorder specifies the recorder of the allocation events.
+func WithRecorder(rec event.Recorder) Option {
+	return func(s Handler) {
+		s.WithRecorder(rec)
+	}
+}
+
+// WithStore specifies the store persisting the pools.
+func WithStore(st store.Store) Option {
+	return func(s Handler) {
+		s.WithStore(st)
+	}
+}
+
+// WithAuditor specifies the auditor recording every mutation of the pools.
+func WithAuditor(a audit.Auditor) Option {
+	return func(s Handler) {
+		s.WithAuditor(a)
+	}
+}
+
+// WithTrigger specifies the trigger which is notified on pool changes.
+func WithTrigger(t trigger.Trigger) Option {
+	return func(s Handler) {
+		s.WithTrigger(t)
+	}
+}
+
 /*
 func WithNewResourceFn(f func() niv1alpha1.Rg) Option {
 	return func(r Handler) {
@@ -43,13 +77,28 @@ type Handler interface {
 	WithLogger(log logging.Logger)
 	//WithPool(pool map[string]hash.HashTable)
 	WithClient(a client.Client)
+	WithTrigger(t trigger.Trigger)
+	WithRecorder(rec event.Recorder)
+	WithStore(s store.Store)
+	WithAuditor(a audit.Auditor)
 	//WithNewResourceFn(f func() niv1alpha1.Rg)
-	Init(string, uint32)
-	Delete(string)
+	Init(context.Context, string, uint32) error
+	Restore(context.Context) error
+	Ready(*http.Request) error
+	Delete(context.Context, string) error
+	Revision(string) uint64
 	GetAllocated(string) (uint32, []*string)
-	ResetSpeedy(string)
-	GetSpeedy(crName string) int
-	IncrementSpeedy(crName string)
+	GetByIndex(string, uint32) (*hash.Entry, error)
+	Query(string, string) (map[string][]*hash.Entry, error)
+	ReleaseBySelector(context.Context, string, string, string) (*ReleaseResult, error)
+	ReleaseAll(context.Context, string, string) (*ReleaseResult, error)
+	ResolveRegistry(context.Context, string, string, string, string) (string, error)
+	Permit(context.Context, string, string) error
+	Permitted(context.Context, string) ([]string, error)
+	Export(string) ([]*PoolSnapshot, error)
+	Import(context.Context, []*PoolSnapshot) error
+	Check(context.Context, string, CheckOptions) ([]*CheckReport, error)
+	Debug(string) []*PoolDebug
 	Register(context.Context, *RegisterInfo) (*uint32, error)
 	DeRegister(context.Context, *RegisterInfo) error
 }
@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/yndd/ndd-runtime/pkg/logging"
+	"github.com/yndd/ndd-runtime/pkg/utils"
+	nddov1 "github.com/yndd/nddo-runtime/apis/common/v1"
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"github.com/yndd/nddr-ni-registry/internal/store"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add core scheme: %v", err)
+	}
+	if err := niv1alpha1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add ni scheme: %v", err)
+	}
+	return s
+}
+
+// newTestRegistry returns a ready registry
+func newTestRegistry(namespace, name string, size uint32) *niv1alpha1.Registry {
+	rg := &niv1alpha1.Registry{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: niv1alpha1.RegistrySpec{
+			Registry: &niv1alpha1.RegistryRegistry{Size: utils.Uint32Ptr(size)},
+		},
+	}
+	rg.SetConditions(niv1alpha1.Ready())
+	return rg
+}
+
+// newTestRegister returns a register of the ni allocating from the registry
+func newTestRegister(namespace, name, registryName, niName string, sourceTag map[string]string) *niv1alpha1.Register {
+	tags := make([]*nddov1.Tag, 0, len(sourceTag))
+	for k, v := range sourceTag {
+		tags = append(tags, &nddov1.Tag{Key: utils.StringPtr(k), Value: utils.StringPtr(v)})
+	}
+	return &niv1alpha1.Register{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: niv1alpha1.RegisterSpec{
+			RegistryName: utils.StringPtr(registryName),
+			Register: &niv1alpha1.NiRegister{
+				Selector:  []*nddov1.Tag{{Key: utils.StringPtr("name"), Value: utils.StringPtr(niName)}},
+				SourceTag: tags,
+			},
+		},
+	}
+}
+
+// newTestHandler returns a handler backed by a fake client with the objects,
+// the pools of the registries are initialized
+func newTestHandler(t *testing.T, objs ...client.Object) (*handler, client.Client) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(objs...).Build()
+	h, err := New(WithLogger(logging.NewNopLogger()), WithClient(c))
+	if err != nil {
+		t.Fatalf("cannot create handler: %v", err)
+	}
+	for _, o := range objs {
+		if rg, ok := o.(*niv1alpha1.Registry); ok {
+			if err := h.Init(context.Background(), rg.GetNamespace()+"."+rg.GetName(), rg.GetSize()); err != nil {
+				t.Fatalf("cannot init pool: %v", err)
+			}
+		}
+	}
+	return h.(*handler), c
+}
+
+// testRegister registers the ni for the registrant in the registry default/rg1
+func testRegister(t *testing.T, h *handler, name, niName string, sourceTag map[string]string) uint32 {
+	t.Helper()
+	idx, err := h.Register(context.Background(), &RegisterInfo{
+		Namespace:    "default",
+		Name:         name,
+		RegistryName: "rg1",
+		CrName:       "default.rg1",
+		Selector:     map[string]string{"name": niName},
+		SourceTag:    sourceTag,
+	})
+	if err != nil {
+		t.Fatalf("cannot register %s: %v", name, err)
+	}
+	return *idx
+}
+
+func TestReleaseBySelector(t *testing.T) {
+	ctx := context.Background()
+	owned := newTestRegister("default", "reg1", "rg1", "blue", map[string]string{"node": "leaf7"})
+	// a register with the name of a grpc registrant, targeting another registry
+	unrelated := newTestRegister("default", "grpc1", "rg2", "red", nil)
+	// a register with the name of the registrant, targeting another ni
+	otherNi := newTestRegister("default", "reg4", "rg1", "yellow", nil)
+	h, c := newTestHandler(t, newTestRegistry("default", "rg1", 16), owned, unrelated, otherNi)
+
+	testRegister(t, h, "reg1", "blue", map[string]string{"node": "leaf7"})
+	testRegister(t, h, "reg3", "blue", map[string]string{"node": "leaf8"})
+	testRegister(t, h, "grpc1", "green", map[string]string{"node": "leaf7"})
+	testRegister(t, h, "reg4", "purple", map[string]string{"node": "leaf7"})
+
+	if _, err := h.ReleaseBySelector(ctx, "default", "default.rg1", ""); err == nil {
+		t.Errorf("an empty selector should be refused")
+	}
+
+	result, err := h.ReleaseBySelector(ctx, "default", "default.rg1", "node=leaf7")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(result.Freed)
+	sort.Strings(result.Registrants)
+	if len(result.Freed) != 2 || result.Freed[0] != "green" || result.Freed[1] != "purple" {
+		t.Errorf("unexpected freed: %v", result.Freed)
+	}
+	if len(result.Retained) != 1 || result.Retained[0] != "blue" {
+		t.Errorf("unexpected retained: %v", result.Retained)
+	}
+	if len(result.Registrants) != 3 {
+		t.Errorf("unexpected registrants: %v", result.Registrants)
+	}
+
+	// only the register targeting the registry with the released ni is deleted
+	err = c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "reg1"}, &niv1alpha1.Register{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("register reg1 should be deleted, got %v", err)
+	}
+	for _, name := range []string{"grpc1", "reg4"} {
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, &niv1alpha1.Register{}); err != nil {
+			t.Errorf("register %s should not be deleted: %v", name, err)
+		}
+	}
+
+	entries, err := h.Query("default.rg1", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries["default.rg1"]) != 1 || entries["default.rg1"][0].Key != "blue" {
+		t.Errorf("only blue of reg3 should be left: %#v", entries["default.rg1"])
+	}
+}
+
+func TestReleaseAllUninitialized(t *testing.T) {
+	h, _ := newTestHandler(t)
+	result, err := h.ReleaseAll(context.Background(), "default", "default.unknown")
+	if err != nil || len(result.Registrants) != 0 {
+		t.Errorf("an uninitialized pool has nothing to release: %v %v", result, err)
+	}
+}
+
+func TestRevision(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+
+	initial := h.Revision("default.rg1")
+	if initial == 0 {
+		t.Fatalf("an initialized pool should have a revision")
+	}
+	testRegister(t, h, "reg1", "blue", nil)
+	registered := h.Revision("default.rg1")
+	if registered <= initial {
+		t.Errorf("a registration should change the revision")
+	}
+	if r := h.Revision("default.rg1"); r != registered {
+		t.Errorf("the revision should not change without a change, got %d", r)
+	}
+
+	if err := h.Delete(ctx, "default.rg1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := h.Revision("default.rg1"); r != 0 {
+		t.Errorf("a deleted pool should have revision 0, got %d", r)
+	}
+	if err := h.Init(ctx, "default.rg1", 16); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := h.Revision("default.rg1"); r <= registered {
+		t.Errorf("a recreated pool should not repeat a revision, got %d", r)
+	}
+}
+
+// failingStore fails every save and update once fail is set, it counts the
+// saves of the complete pool
+type failingStore struct {
+	store.Store
+	fail  bool
+	saves int
+}
+
+func (s *failingStore) Save(ctx context.Context, crName string, entries []*hash.Entry) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	s.saves++
+	return s.Store.Save(ctx, crName, entries)
+}
+
+func (s *failingStore) Update(ctx context.Context, crName string, entries map[uint32]*hash.Entry) error {
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	return s.Store.Update(ctx, crName, entries)
+}
+
+func TestRollbackOnSaveFailure(t *testing.T) {
+	ctx := context.Background()
+	h, _ := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+	st := &failingStore{Store: store.NewMemory()}
+	h.WithStore(st)
+
+	idx := testRegister(t, h, "reg1", "blue", map[string]string{"node": "leaf1"})
+	st.fail = true
+
+	// a failed allocation is not served
+	info := &RegisterInfo{
+		Namespace:    "default",
+		Name:         "reg2",
+		RegistryName: "rg1",
+		CrName:       "default.rg1",
+		Selector:     map[string]string{"name": "red"},
+	}
+	if _, err := h.Register(ctx, info); err == nil {
+		t.Fatalf("the allocation should fail")
+	}
+	if allocated, _ := h.GetAllocated("default.rg1"); allocated != 1 {
+		t.Errorf("the failed allocation should be rolled back, allocated %d", allocated)
+	}
+
+	// a failed update of the source tags keeps the previous tags
+	info = &RegisterInfo{
+		Namespace:    "default",
+		Name:         "reg1",
+		RegistryName: "rg1",
+		CrName:       "default.rg1",
+		Selector:     map[string]string{"name": "blue"},
+		SourceTag:    map[string]string{"node": "leaf2"},
+	}
+	if _, err := h.Register(ctx, info); err == nil {
+		t.Fatalf("the update should fail")
+	}
+	e, err := h.GetByIndex("default.rg1", idx)
+	if err != nil || e.Register["reg1"]["node"] != "leaf1" {
+		t.Errorf("the previous source tags should be restored: %v %v", e, err)
+	}
+
+	// a failed release keeps the registration
+	if err := h.DeRegister(ctx, info); err == nil {
+		t.Fatalf("the release should fail")
+	}
+	if _, err := h.GetByIndex("default.rg1", idx); err != nil {
+		t.Errorf("the failed release should be rolled back: %v", err)
+	}
+	if _, err := h.ReleaseAll(ctx, "default", "default.rg1"); err == nil {
+		t.Fatalf("the release should fail")
+	}
+	if e, err := h.GetByIndex("default.rg1", idx); err != nil || e.Register["reg1"]["node"] != "leaf1" {
+		t.Errorf("the failed release should be rolled back: %v %v", e, err)
+	}
+
+	// the first persist after a failure saves the complete pool
+	st.fail = false
+	if err := h.DeRegister(ctx, info); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, err := st.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("the store should be empty: %v %v", entries, err)
+	}
+	if st.saves != 1 {
+		t.Errorf("expected 1 save of the complete pool, got %d", st.saves)
+	}
+
+	// afterwards only the changed indexes are persisted again
+	idx = testRegister(t, h, "reg3", "green", map[string]string{"node": "leaf3"})
+	if st.saves != 1 {
+		t.Errorf("an allocation should only update the changed index, got %d saves", st.saves)
+	}
+	entries, err = st.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 1 || entries[0].Index != idx || entries[0].Key != "green" {
+		t.Errorf("the store should hold the allocation: %v %v", entries, err)
+	}
+}
+
+func TestInitResize(t *testing.T) {
+	ctx := context.Background()
+	h, c := newTestHandler(t, newTestRegistry("default", "rg1", 16))
+	st := store.NewMemory()
+	h.WithStore(st)
+
+	indexes := make(map[string]uint32)
+	for _, ni := range []string{"blue", "red", "green"} {
+		indexes[ni] = testRegister(t, h, "reg-"+ni, ni, nil)
+	}
+
+	// the pool grows, the allocations keep their index
+	if err := h.Init(ctx, "default.rg1", 256); err != nil {
+		t.Fatalf("cannot grow the pool: %v", err)
+	}
+	if size := h.pool["default.rg1"].Size(); size != 256 {
+		t.Errorf("expected size 256, got %d", size)
+	}
+	for ni, idx := range indexes {
+		if got := testRegister(t, h, "other-"+ni, ni, nil); got != idx {
+			t.Errorf("%s should keep index %d, got %d", ni, idx, got)
+		}
+	}
+	if allocated, _ := h.GetAllocated("default.rg1"); allocated != 3 {
+		t.Errorf("expected 3 allocated, got %d", allocated)
+	}
+
+	// the pool does not shrink below its highest allocated index
+	last := uint32(0)
+	for _, idx := range indexes {
+		if idx > last {
+			last = idx
+		}
+	}
+	if err := h.Init(ctx, "default.rg1", last); !errors.Is(err, ErrPoolShrink) {
+		t.Errorf("expected ErrPoolShrink, got %v", err)
+	}
+	if size := h.pool["default.rg1"].Size(); size != 256 {
+		t.Errorf("a refused shrink should keep size 256, got %d", size)
+	}
+	if err := h.Init(ctx, "default.rg1", last+1); err != nil {
+		t.Fatalf("cannot shrink the pool: %v", err)
+	}
+
+	// a pool persisted before the registry shrunk is restored with all its
+	// allocations, the shrink is refused afterwards
+	restored, err := New(WithLogger(logging.NewNopLogger()), WithClient(c))
+	if err != nil {
+		t.Fatalf("cannot create handler: %v", err)
+	}
+	restored.WithStore(st)
+	if err := restored.Init(ctx, "default.rg1", last); err != nil {
+		t.Fatalf("cannot restore the pool: %v", err)
+	}
+	for ni, idx := range indexes {
+		if e, err := restored.GetByIndex("default.rg1", idx); err != nil || e.Key != ni {
+			t.Errorf("%s should be restored at index %d: %v %v", ni, idx, e, err)
+		}
+	}
+	if err := restored.Init(ctx, "default.rg1", last); !errors.Is(err, ErrPoolShrink) {
+		t.Errorf("expected ErrPoolShrink, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// change is the state of a registration before a change of the pool, it is
+// used to roll back a change the store could not persist
+type change struct {
+	index      uint32
+	key        string
+	registrant string
+	// registered is false when the registrant was not registered before
+	registered bool
+	labels     labels.Set
+}
+
+// before returns the state of the registration of the key at the index, the
+// caller holds the pool mutex
+func before(pool hash.HashTable, index uint32, key, registrant string) change {
+	c := change{index: index, key: key, registrant: registrant}
+	if e, ok := pool.GetByIndex(index); ok && e.Key == key {
+		c.labels, c.registered = e.Register[registrant]
+	}
+	return c
+}
+
+// removed returns the state of the registrations removed from the pool
+func removed(entries []*hash.Entry) []change {
+	changes := make([]change, 0, len(entries))
+	for _, e := range entries {
+		for name, l := range e.Register {
+			changes = append(changes, change{index: e.Index, key: e.Key, registrant: name, registered: true, labels: l})
+		}
+	}
+	return changes
+}
+
+// rollback reverts the changes in reverse order, the caller holds the pool
+// mutex
+func rollback(pool hash.HashTable, changes []change) error {
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if !c.registered {
+			pool.Delete(c.key, c.registrant, nil)
+			continue
+		}
+		if err := pool.Set(&hash.Entry{
+			Index:    c.index,
+			Key:      c.key,
+			Register: map[string]labels.Set{c.registrant: c.labels},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockPool serializes the changes of the pool with their persistence and
+// returns the unlock function. The pool lock is taken before the pool mutex,
+// so a slow store only holds up the changes of its own pool.
+func (r *handler) lockPool(crName string) func() {
+	r.poolMutex.Lock()
+	l, ok := r.poolLocks[crName]
+	if !ok {
+		l = &sync.Mutex{}
+		r.poolLocks[crName] = l
+	}
+	r.poolMutex.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// update is what persist writes to the store
+type update struct {
+	// full saves the entries of the complete pool instead of the changed
+	// indexes
+	full    bool
+	entries []*hash.Entry
+	// changed holds per changed index its entry, nil when the index is free
+	changed map[uint32]*hash.Entry
+}
+
+// snapshot returns the update of the pool for the changes, only the entries at
+// the changed indexes are copied, the complete pool is only copied after a
+// failed persist. The caller holds the pool mutex.
+func (r *handler) snapshot(crName string, pool hash.HashTable, changes []change) *update {
+	r.changed(crName)
+	if r.unsaved[crName] {
+		return &update{full: true, entries: pool.Query(labels.Everything())}
+	}
+	u := &update{changed: make(map[uint32]*hash.Entry, len(changes))}
+	for _, c := range changes {
+		e, _ := pool.GetByIndex(c.index)
+		u.changed[c.index] = e
+	}
+	return u
+}
+
+// persist writes the update of the pool, the caller holds the pool lock but
+// not the pool mutex, so the store only holds up the changes of this pool. A
+// change the store could not persist is rolled back, so the pool does not
+// serve an index the store lost. A store which failed half way is corrected
+// by the next persist, which saves the complete pool.
+func (r *handler) persist(ctx context.Context, crName string, pool hash.HashTable, u *update, changes []change) error {
+	var err error
+	if u.full {
+		err = r.store.Save(ctx, crName, u.entries)
+	} else {
+		err = r.store.Update(ctx, crName, u.changed)
+	}
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+	if err == nil {
+		delete(r.unsaved, crName)
+		return nil
+	}
+	if rerr := rollback(pool, changes); rerr != nil {
+		r.log.Debug("cannot roll back the pool", "crName", crName, "error", rerr)
+	}
+	r.unsaved[crName] = true
+	r.changed(crName)
+	return errors.Wrapf(err, "cannot save pool, crName: %s", crName)
+}
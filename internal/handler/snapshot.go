@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/nddr-ni-registry/internal/audit"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PoolSnapshot is a portable dump of the allocations of the pool of a registry
+type PoolSnapshot struct {
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	Size      uint32        `json:"size"`
+	Entries   []*hash.Entry `json:"entries"`
+}
+
+// Export returns the snapshots of the pools sorted by crName, an empty crName
+// exports all pools
+func (r *handler) Export(crName string) ([]*PoolSnapshot, error) {
+	r.poolMutex.Lock()
+	defer r.poolMutex.Unlock()
+
+	crNames := make([]string, 0, len(r.pool))
+	if crName != "" {
+		if _, ok := r.pool[crName]; !ok {
+			return nil, fmt.Errorf("pool/tree not ready, crName: %s", crName)
+		}
+		crNames = append(crNames, crName)
+	} else {
+		for name := range r.pool {
+			crNames = append(crNames, name)
+		}
+		sort.Strings(crNames)
+	}
+
+	snapshots := make([]*PoolSnapshot, 0, len(crNames))
+	for _, name := range crNames {
+		// crName is <namespace>.<name>, a namespace cannot contain a dot
+		split := strings.SplitN(name, ".", 2)
+		if len(split) != 2 {
+			continue
+		}
+		pool := r.pool[name]
+		snapshots = append(snapshots, &PoolSnapshot{
+			Namespace: split[0],
+			Name:      split[1],
+			Size:      pool.Size(),
+			Entries:   pool.Query(labels.Everything()),
+		})
+	}
+	return snapshots, nil
+}
+
+// Import restores the snapshots into the pools with identical indices. The
+// pools must be initialized with the same size, an entry conflicting with an
+// allocation of the pool fails the import before any pool is changed.
+func (r *handler) Import(ctx context.Context, snapshots []*PoolSnapshot) error {
+	crNames := make([]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		crNames = append(crNames, strings.Join([]string{s.Namespace, s.Name}, "."))
+	}
+	// the pools are locked in order, so concurrent imports cannot deadlock
+	sort.Strings(crNames)
+	for i, crName := range crNames {
+		if i > 0 && crNames[i-1] == crName {
+			continue
+		}
+		unlock := r.lockPool(crName)
+		defer unlock()
+	}
+
+	r.poolMutex.Lock()
+
+	conflicts := make([]string, 0)
+	for _, s := range snapshots {
+		crName := strings.Join([]string{s.Namespace, s.Name}, ".")
+		pool, ok := r.pool[crName]
+		if !ok {
+			conflicts = append(conflicts, fmt.Sprintf("%s: pool not ready, create the registry first", crName))
+			continue
+		}
+		if pool.Size() != s.Size {
+			conflicts = append(conflicts, fmt.Sprintf("%s: size %d differs from the snapshot size %d", crName, pool.Size(), s.Size))
+			continue
+		}
+		keys := make(map[string]uint32, len(s.Entries))
+		indices := make(map[uint32]string, len(s.Entries))
+		for _, e := range s.Entries {
+			if idx, ok := keys[e.Key]; ok && idx != e.Index {
+				conflicts = append(conflicts, fmt.Sprintf("%s: ni %s in the snapshot at index %d and %d", crName, e.Key, idx, e.Index))
+				continue
+			}
+			if key, ok := indices[e.Index]; ok && key != e.Key {
+				conflicts = append(conflicts, fmt.Sprintf("%s: index %d in the snapshot for ni %s and %s", crName, e.Index, key, e.Key))
+				continue
+			}
+			keys[e.Key] = e.Index
+			indices[e.Index] = e.Key
+			if e.Key == "" {
+				conflicts = append(conflicts, fmt.Sprintf("%s: index %d has no ni", crName, e.Index))
+				continue
+			}
+			if e.Index >= pool.Size() {
+				conflicts = append(conflicts, fmt.Sprintf("%s: index %d of ni %s out of range", crName, e.Index, e.Key))
+				continue
+			}
+			if cur, ok := pool.GetByIndex(e.Index); ok && cur.Key != e.Key {
+				conflicts = append(conflicts, fmt.Sprintf("%s: index %d holds ni %s, snapshot ni %s", crName, e.Index, cur.Key, e.Key))
+				continue
+			}
+			if idx, _, ok := pool.Probe(e.Key); ok && idx != e.Index {
+				if cur, ok := pool.GetByIndex(idx); ok && cur.Key == e.Key {
+					conflicts = append(conflicts, fmt.Sprintf("%s: ni %s allocated at index %d, snapshot index %d", crName, e.Key, idx, e.Index))
+				}
+			}
+		}
+	}
+	r.poolMutex.Unlock()
+	if len(conflicts) > 0 {
+		return fmt.Errorf("import conflicts: %s", strings.Join(conflicts, "; "))
+	}
+
+	for _, s := range snapshots {
+		if err := r.importSnapshot(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importSnapshot sets the entries of the snapshot in its pool and persists the
+// pool, the caller holds the pool lock
+func (r *handler) importSnapshot(ctx context.Context, s *PoolSnapshot) error {
+	crName := strings.Join([]string{s.Namespace, s.Name}, ".")
+	r.poolMutex.Lock()
+	pool := r.pool[crName]
+	changes := make([]change, 0)
+	for _, e := range s.Entries {
+		for name := range e.Register {
+			changes = append(changes, before(pool, e.Index, e.Key, name))
+		}
+		if err := pool.Set(e); err != nil {
+			rerr := rollback(pool, changes)
+			r.poolMutex.Unlock()
+			if rerr != nil {
+				r.log.Debug("cannot roll back the pool", "crName", crName, "error", rerr)
+			}
+			return errors.Wrapf(err, "cannot import, crName: %s", crName)
+		}
+	}
+	u := r.snapshot(crName, pool, changes)
+	r.poolMutex.Unlock()
+	err := r.persist(ctx, crName, pool, u, changes)
+	r.notify(ctx, crName)
+	if err != nil {
+		return err
+	}
+	for _, e := range s.Entries {
+		for name, l := range e.Register {
+			r.recordAudit(ctx, audit.ActionImport, crName, e.Key, e.Index, name, l)
+		}
+	}
+	r.log.Debug("pool imported", "crName", crName, "entries", len(s.Entries))
+	return nil
+}
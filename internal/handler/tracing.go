@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/yndd/nddr-ni-registry/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// span attributes
+const (
+	attrCrName     = "registry.crname"
+	attrNiName     = "ni.name"
+	attrNiIndex    = "ni.index"
+	attrRegistrant = "ni.registrant"
+	attrSelector   = "ni.selector"
+	attrReleased   = "ni.released"
+)
+
+var tracer = tracing.Tracer("handler")
+
+// attributes returns the span attributes of the registration
+func (info *RegisterInfo) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(attrCrName, info.CrName),
+		attribute.String(attrNiName, info.Selector["name"]),
+		attribute.String(attrRegistrant, info.registrant()),
+	}
+}
+
+// traceError records the error on the span and returns it
+func traceError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+// Register allocates an index in the pool for the ni of the registration
+func (r *handler) Register(ctx context.Context, info *RegisterInfo) (*uint32, error) {
+	ctx, span := tracer.Start(ctx, "handler.Register", trace.WithAttributes(info.attributes()...))
+	defer span.End()
+	index, err := r.register(ctx, info)
+	if err != nil {
+		return nil, traceError(span, err)
+	}
+	span.SetAttributes(attribute.Int64(attrNiIndex, int64(*index)))
+	return index, nil
+}
+
+// DeRegister releases the registration from the pool
+func (r *handler) DeRegister(ctx context.Context, info *RegisterInfo) error {
+	ctx, span := tracer.Start(ctx, "handler.DeRegister", trace.WithAttributes(info.attributes()...))
+	defer span.End()
+	if err := r.deRegister(ctx, info); err != nil {
+		return traceError(span, err)
+	}
+	return nil
+}
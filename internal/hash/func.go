@@ -0,0 +1,48 @@
+package hash
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+	"sort"
+)
+
+// Func maps a key to a hash index in the range [0, size)
+type Func func(key string, size uint32) uint32
+
+// Sum adds the code points of the key, it is the hash function of the registry
+func Sum(key string, size uint32) uint32 {
+	sum := 0
+	for _, v := range key {
+		sum += int(v)
+	}
+	return uint32(sum) % size
+}
+
+// FNV1a is the 32-bit FNV-1a hash of the key
+func FNV1a(key string, size uint32) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % size
+}
+
+// CRC32 is the IEEE CRC-32 checksum of the key
+func CRC32(key string, size uint32) uint32 {
+	return crc32.ChecksumIEEE([]byte(key)) % size
+}
+
+// Funcs are the available hash functions by name
+var Funcs = map[string]Func{
+	"sum":   Sum,
+	"fnv1a": FNV1a,
+	"crc32": CRC32,
+}
+
+// FuncNames returns the sorted names of the available hash functions
+func FuncNames() []string {
+	names := make([]string, 0, len(Funcs))
+	for name := range Funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,13 +1,29 @@
 package hash
 
 import (
+	"fmt"
+
 	"k8s.io/apimachinery/pkg/labels"
 )
 
 type HashTable interface {
 	Insert(string, string, map[string]string) uint32
+	Probe(string) (uint32, uint32, bool)
+	Set(*Entry) error
+	Size() uint32
+	Stats() Stats
 	Delete(string, string, map[string]string)
 	GetAllocated() (uint32, []*string)
+	GetByIndex(uint32) (*Entry, bool)
+	Query(labels.Selector) []*Entry
+	DeleteBySelector(labels.Selector) []*Entry
+}
+
+// Entry is a snapshot of an allocated slot in the hash table
+type Entry struct {
+	Index    uint32                `json:"index"`
+	Key      string                `json:"key"`
+	Register map[string]labels.Set `json:"register,omitempty"`
 }
 
 type node struct {
@@ -16,14 +32,33 @@ type node struct {
 }
 
 type hashTable struct {
-	size  uint32
-	nodes []*node
+	size   uint32
+	nodes  []*node
+	hashFn Func
+	// index holds the index of every stored key, a key keeps its index when
+	// the entries are set in a table of another size, where its hash differs
+	index map[string]uint32
+}
+
+// Option can be used to manipulate the hash table.
+type Option func(*hashTable)
+
+// WithFunc specifies the hash function of the table, the default is Sum.
+func WithFunc(f Func) Option {
+	return func(h *hashTable) {
+		h.hashFn = f
+	}
 }
 
-func New(s uint32) HashTable {
+func New(s uint32, opts ...Option) HashTable {
 	h := &hashTable{
-		size:  s,
-		nodes: make([]*node, s),
+		size:   s,
+		nodes:  make([]*node, s),
+		hashFn: Sum,
+		index:  make(map[string]uint32),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
 	for i := 0; i < len(h.nodes); i++ {
 		h.nodes[i] = &node{
@@ -34,13 +69,71 @@ func New(s uint32) HashTable {
 }
 
 func (h *hashTable) Insert(k, n string, l map[string]string) uint32 {
+	if idx, ok := h.index[k]; ok {
+		return h.insert(idx, k, n, l)
+	}
 	hidx := h.hash(k)
 	return h.insert(hidx, k, n, l)
 }
 
-func (h *hashTable) Delete(k, n string, l map[string]string) {
+// Probe returns the index at which the key is stored or would be inserted and
+// the amount of collisions probed from its hash index, the bool is false when
+// the key is not stored and the table is full
+func (h *hashTable) Probe(k string) (uint32, uint32, bool) {
 	hidx := h.hash(k)
-	h.delete(0, hidx, k, n, l)
+	if idx, ok := h.index[k]; ok {
+		return idx, (idx + h.size - hidx) % h.size, true
+	}
+	for probe := uint32(0); probe < h.size; probe++ {
+		idx := (hidx + probe) % h.size
+		if h.nodes[idx].key == "" {
+			return idx, probe, true
+		}
+	}
+	return 0, h.size, false
+}
+
+// Set stores the entry at its index, e.g. to restore a persisted table. The
+// registrants are merged with the registrants already stored at the index, an
+// index holding another key or out of range and a key stored at another index
+// return an error.
+func (h *hashTable) Set(e *Entry) error {
+	if e.Index >= h.size {
+		return fmt.Errorf("index %d out of range, size %d", e.Index, h.size)
+	}
+	if e.Key == "" {
+		return fmt.Errorf("index %d has no key", e.Index)
+	}
+	n := h.nodes[e.Index]
+	if n.key != "" && n.key != e.Key {
+		return fmt.Errorf("index %d holds key %s, cannot set key %s", e.Index, n.key, e.Key)
+	}
+	if idx, ok := h.index[e.Key]; ok && idx != e.Index {
+		return fmt.Errorf("key %s is stored at index %d, cannot set index %d", e.Key, idx, e.Index)
+	}
+	if n.key == "" {
+		n = &node{
+			key:      e.Key,
+			register: make(map[string]*labels.Set),
+		}
+		h.nodes[e.Index] = n
+		h.index[e.Key] = e.Index
+	}
+	for name, l := range e.Register {
+		mergedlabel := labels.Merge(l, nil)
+		n.register[name] = &mergedlabel
+	}
+	return nil
+}
+
+func (h *hashTable) Delete(k, n string, l map[string]string) {
+	if idx, ok := h.index[k]; ok {
+		h.delete(0, idx, k, n, l)
+	}
+}
+
+func (h *hashTable) Size() uint32 {
+	return h.size
 }
 
 func (h *hashTable) GetAllocated() (uint32, []*string) {
@@ -55,6 +148,70 @@ func (h *hashTable) GetAllocated() (uint32, []*string) {
 	return allocated, used
 }
 
+// GetByIndex returns the entry stored at index idx, the bool is false when
+// the index is out of range or not allocated
+func (h *hashTable) GetByIndex(idx uint32) (*Entry, bool) {
+	if idx >= h.size || h.nodes[idx].key == "" {
+		return nil, false
+	}
+	return h.nodes[idx].entry(idx), true
+}
+
+// Query returns the allocated entries which have at least one registrant
+// whose source tags match the selector, only the matching registrants are
+// returned in the entry
+func (h *hashTable) Query(s labels.Selector) []*Entry {
+	entries := make([]*Entry, 0)
+	for idx, n := range h.nodes {
+		if n.key == "" {
+			continue
+		}
+		e := n.entry(uint32(idx))
+		for name, l := range e.Register {
+			if !s.Matches(l) {
+				delete(e.Register, name)
+			}
+		}
+		if len(e.Register) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// DeleteBySelector removes every registrant whose source tags match the
+// selector and returns per entry the registrants that were removed, the key is
+// released when no registrants are left
+func (h *hashTable) DeleteBySelector(s labels.Selector) []*Entry {
+	entries := h.Query(s)
+	for _, e := range entries {
+		n := h.nodes[e.Index]
+		for name := range e.Register {
+			delete(n.register, name)
+		}
+		if len(n.register) == 0 {
+			delete(h.index, n.key)
+			h.nodes[e.Index] = &node{
+				register: make(map[string]*labels.Set),
+			}
+		}
+	}
+	return entries
+}
+
+// entry returns a copy of the node, so callers cannot mutate the table
+func (n *node) entry(idx uint32) *Entry {
+	e := &Entry{
+		Index:    idx,
+		Key:      n.key,
+		Register: make(map[string]labels.Set, len(n.register)),
+	}
+	for name, l := range n.register {
+		e.Register[name] = labels.Merge(*l, nil)
+	}
+	return e
+}
+
 func (h *hashTable) insert(hidx uint32, k, n string, l map[string]string) uint32 {
 	mergedlabel := labels.Merge(labels.Set(l), nil)
 	// if entry is empty or the key is already used, insert the key and return the hash index
@@ -65,6 +222,7 @@ func (h *hashTable) insert(hidx uint32, k, n string, l map[string]string) uint32
 				key:      k,
 				register: make(map[string]*labels.Set),
 			}
+			h.index[k] = hidx
 		}
 		h.nodes[hidx].register[n] = &mergedlabel
 		return hidx
@@ -87,6 +245,7 @@ func (h *hashTable) delete(ofidx, hidx uint32, k, n string, l map[string]string)
 		delete(h.nodes[hidx].register, n)
 		// the hash entry has no longer has registers/allocations, so we can delete the key
 		if len(h.nodes[hidx].register) == 0 {
+			delete(h.index, k)
 			h.nodes[hidx] = &node{
 				register: make(map[string]*labels.Set),
 			}
@@ -108,9 +267,5 @@ func (h *hashTable) delete(ofidx, hidx uint32, k, n string, l map[string]string)
 
 // hash
 func (h *hashTable) hash(key string) uint32 {
-	sum := 0
-	for _, v := range key {
-		sum += int(v)
-	}
-	return uint32(sum) % h.size
+	return h.hashFn(key, h.size)
 }
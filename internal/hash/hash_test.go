@@ -3,6 +3,8 @@ package hash
 import (
 	"fmt"
 	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func TestInsertDelete(t *testing.T) {
@@ -51,3 +53,234 @@ func TestInsertDelete(t *testing.T) {
 	}
 
 }
+
+func TestGetByIndex(t *testing.T) {
+	h := New(100)
+
+	idx := h.Insert("blue", "reg1", map[string]string{"node": "leaf1"})
+	h.Insert("blue", "reg2", map[string]string{"node": "leaf2"})
+
+	e, ok := h.GetByIndex(idx)
+	if !ok {
+		t.Fatalf("index %d not found", idx)
+	}
+	if e.Key != "blue" || e.Index != idx {
+		t.Errorf("unexpected entry: %#v", e)
+	}
+	if len(e.Register) != 2 || e.Register["reg2"]["node"] != "leaf2" {
+		t.Errorf("unexpected registrants: %#v", e.Register)
+	}
+
+	if _, ok := h.GetByIndex(idx + 1); ok {
+		t.Errorf("index %d should not be allocated", idx+1)
+	}
+	if _, ok := h.GetByIndex(100); ok {
+		t.Errorf("index out of range should not be found")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	h := New(100)
+
+	h.Insert("blue", "reg1", map[string]string{"node": "leaf1", "tenant": "acme"})
+	h.Insert("blue", "reg2", map[string]string{"node": "leaf2", "tenant": "acme"})
+	h.Insert("red", "reg3", map[string]string{"node": "leaf1", "tenant": "other"})
+
+	s, err := labels.Parse("node=leaf1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := h.Query(s)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if len(e.Register) != 1 {
+			t.Errorf("entry %s: expected only the matching registrant, got %v", e.Key, e.Register)
+		}
+	}
+
+	s, err = labels.Parse("tenant=acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = h.Query(s)
+	if len(entries) != 1 || entries[0].Key != "blue" || len(entries[0].Register) != 2 {
+		t.Errorf("unexpected entries for tenant=acme: %v", entries)
+	}
+}
+
+func TestDeleteBySelector(t *testing.T) {
+	h := New(100)
+
+	blue := h.Insert("blue", "reg1", map[string]string{"node": "leaf7"})
+	h.Insert("blue", "reg2", map[string]string{"node": "leaf8"})
+	red := h.Insert("red", "reg3", map[string]string{"node": "leaf7"})
+
+	s, err := labels.Parse("node=leaf7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released := h.DeleteBySelector(s); len(released) != 2 {
+		t.Fatalf("expected 2 released entries, got %d", len(released))
+	}
+
+	if e, ok := h.GetByIndex(blue); !ok || len(e.Register) != 1 {
+		t.Errorf("blue should be retained with 1 registrant, got %v", e)
+	}
+	if _, ok := h.GetByIndex(red); ok {
+		t.Errorf("red should be freed")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	h := New(3)
+
+	// "ab" and "ba" have the same hash index
+	ab := h.Insert("ab", "reg1", nil)
+	idx, probe, ok := h.Probe("ba")
+	if !ok || probe != 1 || idx != (ab+1)%3 {
+		t.Errorf("unexpected probe of colliding key: idx %d, probe %d, ok %t", idx, probe, ok)
+	}
+	if idx, probe, ok := h.Probe("ab"); !ok || probe != 0 || idx != ab {
+		t.Errorf("unexpected probe of stored key: idx %d, probe %d, ok %t", idx, probe, ok)
+	}
+
+	h.Insert("ba", "reg2", nil)
+	h.Insert("c", "reg3", nil)
+	if _, _, ok := h.Probe("d"); ok {
+		t.Errorf("probe of a full table should fail")
+	}
+	if _, _, ok := h.Probe("c"); !ok {
+		t.Errorf("probe of a stored key in a full table should succeed")
+	}
+}
+
+func TestSet(t *testing.T) {
+	h := New(10)
+
+	if err := h.Set(&Entry{Index: 3, Key: "blue", Register: map[string]labels.Set{"reg1": {"node": "leaf1"}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := h.Set(&Entry{Index: 3, Key: "blue", Register: map[string]labels.Set{"reg2": {"node": "leaf2"}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e, ok := h.GetByIndex(3)
+	if !ok || e.Key != "blue" || len(e.Register) != 2 {
+		t.Errorf("unexpected entry: %#v", e)
+	}
+
+	if err := h.Set(&Entry{Index: 3, Key: "red"}); err == nil {
+		t.Errorf("setting another key at an allocated index should fail")
+	}
+	if err := h.Set(&Entry{Index: 10, Key: "red"}); err == nil {
+		t.Errorf("setting an index out of range should fail")
+	}
+
+	// the set entry is found by a regular delete
+	h.Delete("blue", "reg1", nil)
+	h.Delete("blue", "reg2", nil)
+	if _, ok := h.GetByIndex(3); ok {
+		t.Errorf("blue should be deleted")
+	}
+}
+
+func TestSetOtherSize(t *testing.T) {
+	small := New(8)
+	keys := []string{"blue", "red", "green", "yellow"}
+	for _, k := range keys {
+		small.Insert(k, "reg1", nil)
+	}
+
+	// the entries keep their index in a bigger table, where their hash differs
+	h := New(64)
+	for _, e := range small.Query(labels.Everything()) {
+		if err := h.Set(e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, k := range keys {
+		want, _, _ := small.Probe(k)
+		if idx, _, ok := h.Probe(k); !ok || idx != want {
+			t.Errorf("%s should be probed at index %d, got %d", k, want, idx)
+		}
+		if idx := h.Insert(k, "reg2", nil); idx != want {
+			t.Errorf("%s should be inserted at index %d, got %d", k, want, idx)
+		}
+	}
+	if allocated, _ := h.GetAllocated(); allocated != uint32(len(keys)) {
+		t.Errorf("expected %d allocated, got %d", len(keys), allocated)
+	}
+
+	idx, _, _ := h.Probe("blue")
+	if err := h.Set(&Entry{Index: (idx + 1) % 64, Key: "blue"}); err == nil {
+		t.Errorf("setting a key at another index should fail")
+	}
+
+	h.Delete("blue", "reg1", nil)
+	h.Delete("blue", "reg2", nil)
+	if _, ok := h.GetByIndex(idx); ok {
+		t.Errorf("blue should be deleted")
+	}
+	if e, ok := h.GetByIndex(h.Insert("blue", "reg1", nil)); !ok || e.Key != "blue" {
+		t.Errorf("blue should be inserted again: %v", e)
+	}
+}
+
+func TestWithFunc(t *testing.T) {
+	for _, name := range FuncNames() {
+		f := Funcs[name]
+		h := New(7, WithFunc(f))
+		for _, key := range []string{"ab", "ba", "blue", "red", "infra"} {
+			want, _, ok := h.Probe(key)
+			if !ok {
+				t.Fatalf("%s: table full", name)
+			}
+			if idx := h.Insert(key, "reg", nil); idx != want {
+				t.Errorf("%s: key %s inserted at %d, probed %d", name, key, idx, want)
+			}
+			if f(key, 7) >= 7 {
+				t.Errorf("%s: hash of %s out of range", name, key)
+			}
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	// "ab" and "ba" collide with the sum hash, "ab" is a duplicate
+	s := Simulate([]string{"ab", "ba", "ab", "c"}, 3, "sum", Sum)
+	if s.Keys != 3 || len(s.Placements) != 3 || len(s.Exhausted) != 0 {
+		t.Fatalf("unexpected simulation: %#v", s)
+	}
+	if s.Collisions < 1 || s.LongestProbe < 1 {
+		t.Errorf("expected a collision: %#v", s)
+	}
+	if s.LoadFactor != 1 || s.LongestChain != 3 {
+		t.Errorf("expected a full table: load factor %f, longest chain %d", s.LoadFactor, s.LongestChain)
+	}
+
+	s = Simulate([]string{"a", "b", "c", "d"}, 3, "fnv1a", FNV1a)
+	if len(s.Exhausted) != 1 {
+		t.Errorf("expected one exhausted key: %#v", s.Exhausted)
+	}
+
+	// a table without indices exhausts all keys
+	s = Simulate([]string{"a", "b"}, 0, "sum", Sum)
+	if s.Keys != 2 || len(s.Exhausted) != 2 || len(s.Placements) != 0 || s.LoadFactor != 0 {
+		t.Errorf("expected all keys exhausted: %#v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	// "ab" and "ba" collide with the sum hash
+	h := New(5)
+	h.Insert("ab", "reg1", nil)
+	h.Insert("ba", "reg2", nil)
+	s := h.Stats()
+	if s.Size != 5 || s.Allocated != 2 {
+		t.Fatalf("unexpected stats: %#v", s)
+	}
+	if s.Collisions != 1 || s.LongestProbe != 1 || s.AverageProbe != 0.5 || s.LongestChain != 2 {
+		t.Errorf("unexpected probe stats: %#v", s)
+	}
+}
@@ -0,0 +1,78 @@
+package hash
+
+// Placement is the index assigned to a key by a simulation
+type Placement struct {
+	Key   string `json:"key"`
+	Hash  uint32 `json:"hash"`
+	Index uint32 `json:"index"`
+	Probe uint32 `json:"probe"`
+}
+
+// Simulation reports how keys distribute over a hash table
+type Simulation struct {
+	Func string `json:"func"`
+	Size uint32 `json:"size"`
+	// Keys is the amount of unique keys
+	Keys int `json:"keys"`
+	// Exhausted are the keys which did not fit in the table
+	Exhausted  []string `json:"exhausted,omitempty"`
+	LoadFactor float64  `json:"load-factor"`
+	// Collisions is the amount of keys not stored at their hash index
+	Collisions   int    `json:"collisions"`
+	LongestProbe uint32 `json:"longest-probe"`
+	// LongestChain is the longest run of consecutive allocated indices, a key
+	// hashing into a chain probes until its end
+	LongestChain uint32       `json:"longest-chain"`
+	Placements   []*Placement `json:"placements"`
+}
+
+// Simulate inserts the keys in order into a table of the size with the hash
+// function and reports the assigned indices and the collision statistics. A
+// table of size 0 has no indices, all keys are exhausted.
+func Simulate(keys []string, size uint32, name string, f Func) *Simulation {
+	s := &Simulation{
+		Func:       name,
+		Size:       size,
+		Exhausted:  make([]string, 0),
+		Placements: make([]*Placement, 0, len(keys)),
+	}
+	var h *hashTable
+	if size > 0 {
+		h = New(size, WithFunc(f)).(*hashTable)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		s.Keys++
+		if h == nil {
+			s.Exhausted = append(s.Exhausted, key)
+			continue
+		}
+		idx, probe, ok := h.Probe(key)
+		if !ok {
+			s.Exhausted = append(s.Exhausted, key)
+			continue
+		}
+		h.Insert(key, "simulate", nil)
+		s.Placements = append(s.Placements, &Placement{
+			Key:   key,
+			Hash:  h.hash(key),
+			Index: idx,
+			Probe: probe,
+		})
+		if probe > 0 {
+			s.Collisions++
+		}
+		if probe > s.LongestProbe {
+			s.LongestProbe = probe
+		}
+	}
+	if h != nil {
+		s.LoadFactor = float64(len(s.Placements)) / float64(size)
+		s.LongestChain = h.longestChain()
+	}
+	return s
+}
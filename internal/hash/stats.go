@@ -0,0 +1,60 @@
+package hash
+
+// Stats are the probe statistics of the keys stored in a hash table
+type Stats struct {
+	Size      uint32 `json:"size"`
+	Allocated uint32 `json:"allocated"`
+	// Collisions is the amount of keys not stored at their hash index
+	Collisions   uint32  `json:"collisions"`
+	LongestProbe uint32  `json:"longest-probe"`
+	AverageProbe float64 `json:"average-probe"`
+	// LongestChain is the longest run of consecutive allocated indices, a key
+	// hashing into a chain probes until its end
+	LongestChain uint32 `json:"longest-chain"`
+}
+
+// Stats returns the probe statistics of the table, the probe of a key is the
+// distance from its hash index to the index it is stored at
+func (h *hashTable) Stats() Stats {
+	s := Stats{
+		Size:         h.size,
+		LongestChain: h.longestChain(),
+	}
+	total := uint64(0)
+	for idx, n := range h.nodes {
+		if n.key == "" {
+			continue
+		}
+		s.Allocated++
+		probe := (uint32(idx) + h.size - h.hash(n.key)) % h.size
+		if probe > 0 {
+			s.Collisions++
+		}
+		if probe > s.LongestProbe {
+			s.LongestProbe = probe
+		}
+		total += uint64(probe)
+	}
+	if s.Allocated > 0 {
+		s.AverageProbe = float64(total) / float64(s.Allocated)
+	}
+	return s
+}
+
+// longestChain returns the longest run of consecutive allocated indices, a
+// chain can wrap around the end of the table
+func (h *hashTable) longestChain() uint32 {
+	longest := uint32(0)
+	run := uint32(0)
+	for i := uint32(0); i < 2*h.size && run < h.size; i++ {
+		if h.nodes[i%h.size].key == "" {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
@@ -20,7 +20,6 @@ import (
 
 	"github.com/yndd/ndd-runtime/pkg/logging"
 	"github.com/yndd/nddr-ni-registry/internal/handler"
-	"github.com/yndd/nddr-org-registry/pkg/registry"
 )
 
 type NddControllerOptions struct {
@@ -28,5 +27,6 @@ type NddControllerOptions struct {
 	Poll      time.Duration
 	Namespace string
 	Handler   handler.Handler
-	Registry  registry.Registry
+	// ValidateOda requires the oda of a registry to exist in the org registry
+	ValidateOda bool
 }
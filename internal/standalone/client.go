@@ -0,0 +1,233 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package standalone
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// errors
+	errPatchNotSupported       = "patch is not supported by the in-memory client"
+	errDeleteAllOfNotSupported = "delete all of is not supported by the in-memory client"
+)
+
+type objectKey struct {
+	gvk schema.GroupVersionKind
+	types.NamespacedName
+}
+
+// objects is a client which keeps the objects in memory, it serves the
+// registries of the standalone mode where no api server is available
+type objects struct {
+	scheme *runtime.Scheme
+	mapper meta.RESTMapper
+
+	mutex   sync.RWMutex
+	objects map[objectKey]client.Object
+	version uint64
+}
+
+// NewClient returns a client which keeps the objects in memory, the kinds of
+// the objects must be registered in the scheme. Get, List, Create, Update and
+// Delete are supported, the objects do not survive a restart of the process.
+func NewClient(s *runtime.Scheme, objs ...client.Object) (client.Client, error) {
+	c := &objects{
+		scheme:  s,
+		mapper:  meta.NewDefaultRESTMapper(s.PreferredVersionAllGroups()),
+		objects: make(map[objectKey]client.Object),
+	}
+	for _, obj := range objs {
+		if err := c.Create(context.Background(), obj); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *objects) key(obj runtime.Object, nsName types.NamespacedName) (objectKey, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return objectKey{}, err
+	}
+	return objectKey{gvk: gvk, NamespacedName: nsName}, nil
+}
+
+func (c *objects) gvr(gvk schema.GroupVersionKind) schema.GroupResource {
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return plural.GroupResource()
+}
+
+// copyInto sets the object the pointer obj refers to to a copy of the stored
+// object
+func copyInto(stored, obj runtime.Object) error {
+	src := reflect.ValueOf(stored.DeepCopyObject())
+	dst := reflect.ValueOf(obj)
+	if dst.Kind() != reflect.Ptr || dst.Type() != src.Type() {
+		return fmt.Errorf("cannot copy %T into %T", stored, obj)
+	}
+	dst.Elem().Set(src.Elem())
+	return nil
+}
+
+func (c *objects) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	k, err := c.key(obj, key)
+	if err != nil {
+		return err
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stored, ok := c.objects[k]
+	if !ok {
+		return apierrors.NewNotFound(c.gvr(k.gvk), key.Name)
+	}
+	return copyInto(stored, obj)
+}
+
+func (c *objects) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, c.scheme)
+	if err != nil {
+		return err
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	o := &client.ListOptions{}
+	o.ApplyOptions(opts)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	keys := make([]objectKey, 0)
+	for k, obj := range c.objects {
+		if k.gvk != gvk || (o.Namespace != "" && k.Namespace != o.Namespace) {
+			continue
+		}
+		if o.LabelSelector != nil && !o.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	items := make([]runtime.Object, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, c.objects[k].DeepCopyObject())
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *objects) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	k, err := c.key(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.objects[k]; ok {
+		return apierrors.NewAlreadyExists(c.gvr(k.gvk), k.Name)
+	}
+	c.store(k, obj)
+	return nil
+}
+
+func (c *objects) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	k, err := c.key(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stored, ok := c.objects[k]
+	if !ok {
+		return apierrors.NewNotFound(c.gvr(k.gvk), k.Name)
+	}
+	if v := obj.GetResourceVersion(); v != "" && v != stored.GetResourceVersion() {
+		return apierrors.NewConflict(c.gvr(k.gvk), k.Name, errors.New("the object has been modified"))
+	}
+	c.store(k, obj)
+	return nil
+}
+
+func (c *objects) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	k, err := c.key(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.objects[k]; !ok {
+		return apierrors.NewNotFound(c.gvr(k.gvk), k.Name)
+	}
+	delete(c.objects, k)
+	return nil
+}
+
+func (c *objects) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.New(errPatchNotSupported)
+}
+
+func (c *objects) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return errors.New(errDeleteAllOfNotSupported)
+}
+
+// store keeps a copy of the object with a new resource version, the caller
+// holds the mutex
+func (c *objects) store(k objectKey, obj client.Object) {
+	c.version++
+	obj.SetResourceVersion(fmt.Sprintf("%d", c.version))
+	c.objects[k] = obj.DeepCopyObject().(client.Object)
+}
+
+func (c *objects) Status() client.StatusWriter {
+	return &objectsStatus{objects: c}
+}
+
+func (c *objects) Scheme() *runtime.Scheme {
+	return c.scheme
+}
+
+func (c *objects) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+// objectsStatus updates the objects as a whole, the in-memory client has no
+// status subresource
+type objectsStatus struct {
+	objects *objects
+}
+
+func (s *objectsStatus) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return s.objects.Update(ctx, obj)
+}
+
+func (s *objectsStatus) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.New(errPatchNotSupported)
+}
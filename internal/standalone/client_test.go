@@ -0,0 +1,81 @@
+package standalone
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add core scheme: %v", err)
+	}
+	c, err := NewClient(s,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cm1", Labels: map[string]string{"a": "b"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cm2"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "cm1"}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cm1"}, cm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cm3"}, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: "default"}, &corev1.Namespace{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a not found error for another kind, got %v", err)
+	}
+
+	cml := &corev1.ConfigMapList{}
+	if err := c.List(ctx, cml, client.InNamespace("default")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cml.Items) != 2 || cml.Items[0].GetName() != "cm1" {
+		t.Errorf("expected the 2 configmaps of the namespace, got %v", cml.Items)
+	}
+	if err := c.List(ctx, cml, client.MatchingLabels{"a": "b"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cml.Items) != 1 {
+		t.Errorf("expected the labeled configmap, got %v", cml.Items)
+	}
+
+	// an update of a stale copy conflicts
+	stale := cm.DeepCopy()
+	cm.Data = map[string]string{"k": "v"}
+	if err := c.Update(ctx, cm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Update(ctx, stale); !apierrors.IsConflict(err) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	got := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), got); err != nil || got.Data["k"] != "v" {
+		t.Errorf("the update should be stored: %v %v", got.Data, err)
+	}
+
+	// the stored object is a copy
+	got.Data["k"] = "x"
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), got); err != nil || got.Data["k"] != "v" {
+		t.Errorf("the stored object should not change: %v %v", got.Data, err)
+	}
+
+	if err := c.Delete(ctx, cm); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(cm), got); !apierrors.IsNotFound(err) {
+		t.Errorf("expected a not found error after the delete, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	configMapSuffix = "-pool"
+	// configMapShardSize is the amount of indexes per configmap shard, an entry
+	// carries the source tags of all its registrants
+	configMapShardSize = 250
+	// errors
+	errGetConfigMap    = "cannot get the pool configmaps"
+	errApplyConfigMap  = "cannot apply the pool configmaps"
+	errDeleteConfigMap = "cannot delete the pool configmaps"
+	errDecodeEntries   = "cannot decode the pool entries"
+	errEncodeEntries   = "cannot encode the pool entries"
+)
+
+type configMap struct {
+	shards *Shards
+
+	mutex sync.Mutex
+	// pools holds the data per shard of the pools which were loaded or saved,
+	// so an update only encodes and writes the shards of the changed indexes
+	pools map[string]map[int]map[string]string
+}
+
+// NewConfigMap returns a store which persists the entries of a pool in the
+// configmaps <name>-pool-<shard> in the namespace of its registry. The entries
+// are sharded by index, a save only writes the shards which changed, an update
+// only writes the shards of the changed indexes.
+func NewConfigMap(c client.Client) Store {
+	return &configMap{
+		shards: NewShards(c),
+		pools:  make(map[string]map[int]map[string]string),
+	}
+}
+
+func (s *configMap) Load(ctx context.Context, crName string) ([]*hash.Entry, error) {
+	namespace, name, err := splitCrName(crName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.shards.Read(ctx, namespace, name+configMapSuffix)
+	if err != nil {
+		return nil, errors.Wrap(err, errGetConfigMap)
+	}
+	entries := make([]*hash.Entry, 0, len(data))
+	shards := make(map[int]map[string]string)
+	for _, d := range data {
+		e := &hash.Entry{}
+		if err := json.Unmarshal([]byte(d), e); err != nil {
+			return nil, errors.Wrap(err, errDecodeEntries)
+		}
+		entries = append(entries, e)
+		addToShard(shards, e.Index, d)
+	}
+	s.cache(crName, shards)
+	return entries, nil
+}
+
+func (s *configMap) Save(ctx context.Context, crName string, entries []*hash.Entry) error {
+	namespace, name, err := splitCrName(crName)
+	if err != nil {
+		return err
+	}
+	shards := make(map[int]map[string]string)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, errEncodeEntries)
+		}
+		addToShard(shards, e.Index, string(data))
+	}
+	if _, err := s.shards.Write(ctx, namespace, name+configMapSuffix, nil, shards); err != nil {
+		s.cache(crName, nil)
+		return errors.Wrap(err, errApplyConfigMap)
+	}
+	s.cache(crName, shards)
+	return nil
+}
+
+func (s *configMap) Update(ctx context.Context, crName string, entries map[uint32]*hash.Entry) error {
+	namespace, name, err := splitCrName(crName)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	cached, ok := s.pools[crName]
+	s.mutex.Unlock()
+	if !ok {
+		// the pool was not loaded by this process, read its shards once
+		if _, err := s.Load(ctx, crName); err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		cached = s.pools[crName]
+		s.mutex.Unlock()
+	}
+
+	// copy the shards of the changed indexes, the cache only changes when
+	// they are written
+	shards := make(map[int]map[string]string)
+	for idx, e := range entries {
+		shard := int(idx / configMapShardSize)
+		if _, ok := shards[shard]; !ok {
+			shards[shard] = make(map[string]string, len(cached[shard])+1)
+			for k, v := range cached[shard] {
+				shards[shard][k] = v
+			}
+		}
+		if e == nil {
+			delete(shards[shard], strconv.Itoa(int(idx)))
+			continue
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, errEncodeEntries)
+		}
+		shards[shard][strconv.Itoa(int(idx))] = string(data)
+	}
+	if err := s.shards.Update(ctx, namespace, name+configMapSuffix, nil, shards); err != nil {
+		// some shards may be written, the next load or save rebuilds the cache
+		s.cache(crName, nil)
+		return errors.Wrap(err, errApplyConfigMap)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if pool, ok := s.pools[crName]; ok {
+		for shard, data := range shards {
+			pool[shard] = data
+		}
+	}
+	return nil
+}
+
+func (s *configMap) Delete(ctx context.Context, crName string) error {
+	namespace, name, err := splitCrName(crName)
+	if err != nil {
+		return err
+	}
+	s.cache(crName, nil)
+	return errors.Wrap(s.shards.Delete(ctx, namespace, name+configMapSuffix), errDeleteConfigMap)
+}
+
+// cache keeps the data per shard of the pool, nil drops the pool from the cache
+func (s *configMap) cache(crName string, shards map[int]map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if shards == nil {
+		delete(s.pools, crName)
+		return
+	}
+	s.pools[crName] = shards
+}
+
+// addToShard adds the encoded entry at the index to its shard
+func addToShard(shards map[int]map[string]string, index uint32, data string) {
+	shard := int(index / configMapShardSize)
+	if _, ok := shards[shard]; !ok {
+		shards[shard] = make(map[string]string)
+	}
+	shards[shard][strconv.Itoa(int(index))] = data
+}
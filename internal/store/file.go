@@ -0,0 +1,231 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+const (
+	fileSuffix = ".json"
+	// fileShardSize is the amount of indexes per shard file, an update only
+	// rewrites the shard files of the changed indexes
+	fileShardSize = 250
+	// errors
+	errCreateDir  = "cannot create the store directory"
+	errReadFile   = "cannot read the pool file"
+	errWriteFile  = "cannot write the pool file"
+	errDeleteFile = "cannot delete the pool file"
+)
+
+type file struct {
+	mutex sync.Mutex
+	dir   string
+}
+
+// NewFile returns a store which persists the entries of a pool in the json
+// files <dir>/<namespace>.<name>/<shard>.json, the entries are sharded by
+// index and a file is replaced atomically on write.
+func NewFile(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrap(err, errCreateDir)
+	}
+	return &file{
+		dir: dir,
+	}, nil
+}
+
+func (s *file) Load(ctx context.Context, crName string) ([]*hash.Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	shards, err := s.shards(crName)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*hash.Entry, 0)
+	for _, shard := range shards {
+		e, err := s.read(crName, shard)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e...)
+	}
+	return entries, nil
+}
+
+func (s *file) Save(ctx context.Context, crName string, entries []*hash.Entry) error {
+	shards := make(map[int][]*hash.Entry)
+	for _, e := range entries {
+		shard := int(e.Index / fileShardSize)
+		shards[shard] = append(shards[shard], e)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	existing, err := s.shards(crName)
+	if err != nil {
+		return err
+	}
+	for _, shard := range existing {
+		if _, ok := shards[shard]; !ok {
+			shards[shard] = nil
+		}
+	}
+	for shard, e := range shards {
+		if err := s.write(crName, shard, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *file) Update(ctx context.Context, crName string, entries map[uint32]*hash.Entry) error {
+	changed := make(map[int]map[uint32]*hash.Entry)
+	for idx, e := range entries {
+		shard := int(idx / fileShardSize)
+		if _, ok := changed[shard]; !ok {
+			changed[shard] = make(map[uint32]*hash.Entry)
+		}
+		changed[shard][idx] = e
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for shard, c := range changed {
+		existing, err := s.read(crName, shard)
+		if err != nil {
+			return err
+		}
+		merged := make([]*hash.Entry, 0, len(existing)+len(c))
+		for _, e := range existing {
+			if _, ok := c[e.Index]; !ok {
+				merged = append(merged, e)
+			}
+		}
+		for _, e := range c {
+			if e != nil {
+				merged = append(merged, e)
+			}
+		}
+		if err := s.write(crName, shard, merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *file) Delete(ctx context.Context, crName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.RemoveAll(filepath.Join(s.dir, crName)); err != nil {
+		return errors.Wrap(err, errDeleteFile)
+	}
+	return nil
+}
+
+// shards returns the shards of the pool which have a file, the caller holds
+// the mutex
+func (s *file) shards(crName string) ([]int, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, crName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, errReadFile)
+	}
+	shards := make([]int, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileSuffix) {
+			continue
+		}
+		shard, err := strconv.Atoi(strings.TrimSuffix(f.Name(), fileSuffix))
+		if err != nil || shard < 0 {
+			continue
+		}
+		shards = append(shards, shard)
+	}
+	sort.Ints(shards)
+	return shards, nil
+}
+
+// read returns the entries of the shard, the caller holds the mutex
+func (s *file) read(crName string, shard int) ([]*hash.Entry, error) {
+	data, err := ioutil.ReadFile(s.path(crName, shard))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, errReadFile)
+	}
+	entries := make([]*hash.Entry, 0)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, errDecodeEntries)
+	}
+	return entries, nil
+}
+
+// write replaces the file of the shard, a shard without entries is removed,
+// the caller holds the mutex
+func (s *file) write(crName string, shard int, entries []*hash.Entry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(s.path(crName, shard)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, errDeleteFile)
+		}
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, errEncodeEntries)
+	}
+	dir := filepath.Join(s.dir, crName)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return errors.Wrap(err, errCreateDir)
+	}
+	tmp, err := ioutil.TempFile(dir, strconv.Itoa(shard)+"-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, errWriteFile)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, errWriteFile)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, errWriteFile)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, errWriteFile)
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), s.path(crName, shard)), errWriteFile)
+}
+
+func (s *file) path(crName string, shard int) string {
+	return filepath.Join(s.dir, crName, strconv.Itoa(shard)+fileSuffix)
+}
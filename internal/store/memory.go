@@ -0,0 +1,91 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+type memory struct {
+	mutex sync.Mutex
+	pools map[string]map[uint32]*hash.Entry
+}
+
+// NewMemory returns a store which keeps the entries in memory, they do not
+// survive a restart of the process.
+func NewMemory() Store {
+	return &memory{
+		pools: make(map[string]map[uint32]*hash.Entry),
+	}
+}
+
+func (s *memory) Load(ctx context.Context, crName string) ([]*hash.Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pool, ok := s.pools[crName]
+	if !ok {
+		return nil, nil
+	}
+	entries := make([]*hash.Entry, 0, len(pool))
+	for _, e := range pool {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	return entries, nil
+}
+
+func (s *memory) Save(ctx context.Context, crName string, entries []*hash.Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pool := make(map[uint32]*hash.Entry, len(entries))
+	for _, e := range entries {
+		pool[e.Index] = e
+	}
+	s.pools[crName] = pool
+	return nil
+}
+
+func (s *memory) Update(ctx context.Context, crName string, entries map[uint32]*hash.Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pool, ok := s.pools[crName]
+	if !ok {
+		pool = make(map[uint32]*hash.Entry, len(entries))
+		s.pools[crName] = pool
+	}
+	for idx, e := range entries {
+		if e == nil {
+			delete(pool, idx)
+			continue
+		}
+		pool[idx] = e
+	}
+	return nil
+}
+
+func (s *memory) Delete(ctx context.Context, crName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pools, crName)
+	return nil
+}
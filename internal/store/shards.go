@@ -0,0 +1,296 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ShardLabelKey labels every shard with the prefix of its configmaps
+	ShardLabelKey = "ni.nddr.yndd.io/shard-of"
+	// errors
+	errListShards  = "cannot list the configmap shards"
+	errGetShard    = "cannot get the configmap shard"
+	errApplyShard  = "cannot apply the configmap shard"
+	errDeleteShard = "cannot delete the configmap shard"
+	errEncodeShard = "cannot encode the configmap shard"
+)
+
+// Shards spreads data over configmaps named <prefix>-<shard> to stay below
+// the size limit of a single configmap. The shards carry a label with their
+// prefix, a shard which is no longer written is deleted, a shard whose data
+// did not change since the last write is not written again.
+type Shards struct {
+	client client.Client
+
+	mutex sync.Mutex
+	sets  map[string]*shardSet
+}
+
+// shardSet tracks the shards of a prefix, its lock serializes the writes
+type shardSet struct {
+	sync.Mutex
+	// listed is set once the shards left by an earlier process are known
+	listed bool
+	// digest of the data per shard of the last write, an empty digest forces
+	// the next write
+	digests map[int]string
+}
+
+// NewShards returns configmap shards written with the client
+func NewShards(c client.Client) *Shards {
+	return &Shards{
+		client: c,
+		sets:   make(map[string]*shardSet),
+	}
+}
+
+// ShardName returns the name of the configmap of the shard
+func ShardName(prefix string, shard int) string {
+	return prefix + "-" + strconv.Itoa(shard)
+}
+
+// Write writes the data per shard of the prefix. A shard without data and a
+// shard of an earlier write which is missing are deleted. The owner is set on
+// the configmaps so they are garbage collected with their owner. Write
+// returns the amount of shards holding data.
+func (s *Shards) Write(ctx context.Context, namespace, prefix string, owner *metav1.OwnerReference, shards map[int]map[string]string) (int, error) {
+	set := s.set(namespace, prefix)
+	set.Lock()
+	defer set.Unlock()
+
+	if !set.listed {
+		existing, err := s.list(ctx, namespace, prefix)
+		if err != nil {
+			return 0, err
+		}
+		for shard := range existing {
+			if _, ok := set.digests[shard]; !ok {
+				set.digests[shard] = ""
+			}
+		}
+		set.listed = true
+	}
+
+	written := 0
+	for shard, data := range shards {
+		if len(data) == 0 {
+			continue
+		}
+		written++
+		if err := s.write(ctx, set, namespace, prefix, shard, owner, data); err != nil {
+			return 0, err
+		}
+	}
+
+	for shard := range set.digests {
+		if data, ok := shards[shard]; ok && len(data) > 0 {
+			continue
+		}
+		if err := s.delete(ctx, namespace, ShardName(prefix, shard)); err != nil {
+			return 0, err
+		}
+		delete(set.digests, shard)
+	}
+	return written, nil
+}
+
+// Update writes only the given shards of the prefix, a shard without data is
+// deleted, the other shards are left as they are
+func (s *Shards) Update(ctx context.Context, namespace, prefix string, owner *metav1.OwnerReference, shards map[int]map[string]string) error {
+	set := s.set(namespace, prefix)
+	set.Lock()
+	defer set.Unlock()
+
+	for shard, data := range shards {
+		if len(data) > 0 {
+			if err := s.write(ctx, set, namespace, prefix, shard, owner, data); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.delete(ctx, namespace, ShardName(prefix, shard)); err != nil {
+			return err
+		}
+		delete(set.digests, shard)
+	}
+	return nil
+}
+
+// write applies the data of the shard unless it did not change since the last
+// write, the caller holds the lock of the set
+func (s *Shards) write(ctx context.Context, set *shardSet, namespace, prefix string, shard int, owner *metav1.OwnerReference, data map[string]string) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, errEncodeShard)
+	}
+	digest := fmt.Sprintf("%x", sha256.Sum256(b))
+	if d, ok := set.digests[shard]; ok && d == digest {
+		return nil
+	}
+	if err := s.apply(ctx, namespace, prefix, shard, owner, data); err != nil {
+		return err
+	}
+	set.digests[shard] = digest
+	return nil
+}
+
+// Read returns the data of all shards of the prefix
+func (s *Shards) Read(ctx context.Context, namespace, prefix string) (map[string]string, error) {
+	existing, err := s.list(ctx, namespace, prefix)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string)
+	for _, cm := range existing {
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
+
+// Delete deletes all shards of the prefix
+func (s *Shards) Delete(ctx context.Context, namespace, prefix string) error {
+	set := s.set(namespace, prefix)
+	set.Lock()
+	defer set.Unlock()
+
+	existing, err := s.list(ctx, namespace, prefix)
+	if err != nil {
+		return err
+	}
+	for shard := range existing {
+		set.digests[shard] = ""
+	}
+	for shard := range set.digests {
+		if err := s.delete(ctx, namespace, ShardName(prefix, shard)); err != nil {
+			return err
+		}
+		delete(set.digests, shard)
+	}
+	set.listed = true
+	return nil
+}
+
+// Forget drops what is known about the shards of the prefix, to be used when
+// the shards are garbage collected through their owner
+func (s *Shards) Forget(namespace, prefix string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sets, namespace+"/"+prefix)
+}
+
+func (s *Shards) set(namespace, prefix string) *shardSet {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := namespace + "/" + prefix
+	set, ok := s.sets[key]
+	if !ok {
+		set = &shardSet{digests: make(map[int]string)}
+		s.sets[key] = set
+	}
+	return set
+}
+
+// list returns the configmaps per shard of the prefix
+func (s *Shards) list(ctx context.Context, namespace, prefix string) (map[int]*corev1.ConfigMap, error) {
+	cml := &corev1.ConfigMapList{}
+	if err := s.client.List(ctx, cml, client.InNamespace(namespace), client.MatchingLabels{ShardLabelKey: shardLabelValue(prefix)}); err != nil {
+		return nil, errors.Wrap(err, errListShards)
+	}
+	existing := make(map[int]*corev1.ConfigMap, len(cml.Items))
+	for i := range cml.Items {
+		cm := &cml.Items[i]
+		// the label value of a long prefix is a digest, the name decides
+		if !strings.HasPrefix(cm.GetName(), prefix+"-") {
+			continue
+		}
+		shard, err := strconv.Atoi(strings.TrimPrefix(cm.GetName(), prefix+"-"))
+		if err != nil || shard < 0 {
+			continue
+		}
+		existing[shard] = cm
+	}
+	return existing, nil
+}
+
+func (s *Shards) apply(ctx context.Context, namespace, prefix string, shard int, owner *metav1.OwnerReference, data map[string]string) error {
+	cm := &corev1.ConfigMap{}
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ShardName(prefix, shard)}, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, errGetShard)
+	}
+	create := apierrors.IsNotFound(err)
+	if create {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      ShardName(prefix, shard),
+			},
+		}
+	}
+	labels := cm.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[ShardLabelKey] = shardLabelValue(prefix)
+	cm.SetLabels(labels)
+	if owner != nil {
+		cm.SetOwnerReferences([]metav1.OwnerReference{*owner})
+	}
+	cm.Data = data
+
+	if create {
+		return errors.Wrap(s.client.Create(ctx, cm), errApplyShard)
+	}
+	return errors.Wrap(s.client.Update(ctx, cm), errApplyShard)
+}
+
+func (s *Shards) delete(ctx context.Context, namespace, name string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+	return errors.Wrap(client.IgnoreNotFound(s.client.Delete(ctx, cm)), errDeleteShard)
+}
+
+// shardLabelValue returns the prefix as label value, a prefix which is not a
+// valid label value is replaced by its digest
+func shardLabelValue(prefix string) string {
+	if len(validation.IsValidLabelValue(prefix)) == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(prefix)))[:validation.LabelValueMaxLength]
+}
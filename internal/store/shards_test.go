@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		t.Fatalf("cannot add core scheme: %v", err)
+	}
+	return fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()
+}
+
+func getShard(t *testing.T, c client.Client, name string) (*corev1.ConfigMap, bool) {
+	t.Helper()
+	cm := &corev1.ConfigMap{}
+	err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, false
+	}
+	if err != nil {
+		t.Fatalf("cannot get %s: %v", name, err)
+	}
+	return cm, true
+}
+
+func TestShardsWrite(t *testing.T) {
+	ctx := context.Background()
+	// a shard left behind by an earlier process, and a configmap which is not a shard
+	stale := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "rg1-ledger-7",
+		Labels:    map[string]string{ShardLabelKey: "rg1-ledger"},
+	}}
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "rg1-ledger-x"}}
+	c := newTestClient(t, stale, other)
+	s := NewShards(c)
+
+	n, err := s.Write(ctx, "default", "rg1-ledger", nil, map[int]map[string]string{
+		0: {"1": "a"},
+		1: {"1001": "b"},
+		2: {},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 shards, got %d", n)
+	}
+	if _, ok := getShard(t, c, "rg1-ledger-7"); ok {
+		t.Errorf("the stale shard should be deleted")
+	}
+	if _, ok := getShard(t, c, "rg1-ledger-x"); !ok {
+		t.Errorf("a configmap without the shard label should be kept")
+	}
+	if _, ok := getShard(t, c, "rg1-ledger-2"); ok {
+		t.Errorf("an empty shard should not be written")
+	}
+
+	// the pool shrinks, shard 1 is gone
+	if _, err := s.Write(ctx, "default", "rg1-ledger", nil, map[int]map[string]string{0: {"1": "c"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := getShard(t, c, "rg1-ledger-1"); ok {
+		t.Errorf("shard 1 should be deleted after the shrink")
+	}
+	cm, ok := getShard(t, c, "rg1-ledger-0")
+	if !ok || cm.Data["1"] != "c" {
+		t.Errorf("shard 0 should be updated: %v", cm)
+	}
+
+	data, err := s.Read(ctx, "default", "rg1-ledger")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 1 || data["1"] != "c" {
+		t.Errorf("unexpected data: %v", data)
+	}
+
+	if err := s.Delete(ctx, "default", "rg1-ledger"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := getShard(t, c, "rg1-ledger-0"); ok {
+		t.Errorf("shard 0 should be deleted")
+	}
+}
+
+func TestShardsUnchanged(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	s := NewShards(c)
+
+	shards := map[int]map[string]string{0: {"1": "a"}}
+	if _, err := s.Write(ctx, "default", "rg1-pool", nil, shards); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, _ := getShard(t, c, "rg1-pool-0")
+	version := cm.GetResourceVersion()
+
+	if _, err := s.Write(ctx, "default", "rg1-pool", nil, shards); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cm, _ = getShard(t, c, "rg1-pool-0")
+	if cm.GetResourceVersion() != version {
+		t.Errorf("an unchanged shard should not be written again")
+	}
+}
+
+func TestShardLabelValue(t *testing.T) {
+	if v := shardLabelValue("rg1-pool"); v != "rg1-pool" {
+		t.Errorf("a valid prefix should be the label value, got %s", v)
+	}
+	long := strings.Repeat("a", 70)
+	v := shardLabelValue(long)
+	if len(v) != 63 || v == long[:63] {
+		t.Errorf("a long prefix should be replaced by its digest, got %s", v)
+	}
+
+	ctx := context.Background()
+	c := newTestClient(t)
+	s := NewShards(c)
+	if _, err := s.Write(ctx, "default", long, nil, map[int]map[string]string{0: {"1": "a"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := s.Read(ctx, "default", long)
+	if err != nil || data["1"] != "a" {
+		t.Errorf("the shards of a long prefix should be read: %v %v", data, err)
+	}
+}
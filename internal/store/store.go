@@ -0,0 +1,61 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+)
+
+// Kinds of store
+const (
+	// KindMemory keeps the pools in memory only, they are rebuilt from the
+	// registers after a restart
+	KindMemory = "memory"
+	// KindConfigMap persists every pool in a configmap next to its registry
+	KindConfigMap = "configmap"
+	// KindFile persists every pool in json files in a local directory
+	KindFile = "file"
+)
+
+// Store persists the entries of the pools, a pool is identified by the
+// crName <namespace>.<name> of its registry.
+type Store interface {
+	// Load returns the persisted entries of the pool, a pool that was never
+	// saved has no entries
+	Load(ctx context.Context, crName string) ([]*hash.Entry, error)
+	// Save replaces the persisted entries of the pool
+	Save(ctx context.Context, crName string, entries []*hash.Entry) error
+	// Update persists the entries at the changed indexes of the pool, a nil
+	// entry frees its index, the other entries are left as they are
+	Update(ctx context.Context, crName string, entries map[uint32]*hash.Entry) error
+	// Delete removes the persisted entries of the pool
+	Delete(ctx context.Context, crName string) error
+}
+
+// splitCrName returns the namespace and name of the registry of the pool
+func splitCrName(crName string) (string, string, error) {
+	// a namespace cannot contain a dot
+	split := strings.SplitN(crName, ".", 2)
+	if len(split) != 2 {
+		return "", "", fmt.Errorf("invalid crName %s, expected <namespace>.<name>", crName)
+	}
+	return split[0], split[1], nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/yndd/nddr-ni-registry/internal/hash"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func testEntries(indexes ...uint32) []*hash.Entry {
+	entries := make([]*hash.Entry, 0, len(indexes))
+	for _, idx := range indexes {
+		entries = append(entries, &hash.Entry{
+			Index:    idx,
+			Key:      "ni" + string(rune('a'+idx%26)),
+			Register: map[string]labels.Set{"reg1": {"node": "leaf1"}},
+		})
+	}
+	return entries
+}
+
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	entries, err := s.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("a pool that was never saved has no entries: %v %v", entries, err)
+	}
+
+	if err := s.Save(ctx, "default.rg1", testEntries(1, 300, 600)); err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	entries, err = s.Load(ctx, "default.rg1")
+	if err != nil {
+		t.Fatalf("cannot load: %v", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+	if len(entries) != 3 || entries[1].Index != 300 || entries[1].Register["reg1"]["node"] != "leaf1" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	// the pool shrinks
+	if err := s.Save(ctx, "default.rg1", testEntries(1)); err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	entries, err = s.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected 1 entry after the shrink: %v %v", entries, err)
+	}
+
+	// an update only changes the given indexes
+	update := map[uint32]*hash.Entry{1: nil, 301: testEntries(301)[0], 302: testEntries(302)[0]}
+	if err := s.Update(ctx, "default.rg1", update); err != nil {
+		t.Fatalf("cannot update: %v", err)
+	}
+	if err := s.Update(ctx, "default.rg1", map[uint32]*hash.Entry{302: nil}); err != nil {
+		t.Fatalf("cannot update: %v", err)
+	}
+	entries, err = s.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 1 || entries[0].Index != 301 {
+		t.Errorf("expected the entry at 301 after the update: %v %v", entries, err)
+	}
+
+	// an update of a pool that was never saved
+	if err := s.Update(ctx, "default.rg2", map[uint32]*hash.Entry{7: testEntries(7)[0]}); err != nil {
+		t.Fatalf("cannot update: %v", err)
+	}
+	entries, err = s.Load(ctx, "default.rg2")
+	if err != nil || len(entries) != 1 || entries[0].Index != 7 {
+		t.Errorf("expected the entry at 7 after the update: %v %v", entries, err)
+	}
+
+	if err := s.Delete(ctx, "default.rg1"); err != nil {
+		t.Fatalf("cannot delete: %v", err)
+	}
+	entries, err = s.Load(ctx, "default.rg1")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("a deleted pool has no entries: %v %v", entries, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestFile(t *testing.T) {
+	s, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatalf("cannot create the store: %v", err)
+	}
+	testStore(t, s)
+}
+
+func TestConfigMap(t *testing.T) {
+	c := newTestClient(t)
+	testStore(t, NewConfigMap(c))
+
+	// every shard is written to its own configmap
+	s := NewConfigMap(c)
+	if err := s.Save(context.Background(), "default.rg1", testEntries(1, 300, 600)); err != nil {
+		t.Fatalf("cannot save: %v", err)
+	}
+	for _, name := range []string{"rg1-pool-0", "rg1-pool-1", "rg1-pool-2"} {
+		if _, ok := getShard(t, c, name); !ok {
+			t.Errorf("shard %s should exist", name)
+		}
+	}
+
+	// an update only writes the shard of the changed index
+	cm, _ := getShard(t, c, "rg1-pool-0")
+	if err := s.Update(context.Background(), "default.rg1", map[uint32]*hash.Entry{601: testEntries(601)[0]}); err != nil {
+		t.Fatalf("cannot update: %v", err)
+	}
+	if got, _ := getShard(t, c, "rg1-pool-0"); got.GetResourceVersion() != cm.GetResourceVersion() {
+		t.Errorf("the shard without changes should not be written")
+	}
+	if got, _ := getShard(t, c, "rg1-pool-2"); len(got.Data) != 2 {
+		t.Errorf("the shard of the changed index should hold 2 entries: %v", got.Data)
+	}
+
+	// an update freeing the last index of a shard deletes it
+	if err := s.Update(context.Background(), "default.rg1", map[uint32]*hash.Entry{300: nil}); err != nil {
+		t.Fatalf("cannot update: %v", err)
+	}
+	if _, ok := getShard(t, c, "rg1-pool-1"); ok {
+		t.Errorf("the empty shard should be deleted")
+	}
+
+	if err := s.Save(context.Background(), "rg1", nil); err == nil {
+		t.Errorf("an invalid crName should be refused")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 NDD.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	niv1alpha1 "github.com/yndd/nddr-ni-registry/apis/ni/v1alpha1"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// Trigger turns pool change notifications into registry reconciliations.
+// Notifications for the same registry are debounced, so a burst of
+// allocations results in a single status refresh.
+type Trigger interface {
+	// Notify signals a change in the pool of the registry with crName
+	// <namespace>.<name>, the span of the context is linked to the reconcile
+	Notify(ctx context.Context, crName string)
+	// Pending returns per crName the time of the first change which is not
+	// yet sent as event
+	Pending() map[string]time.Time
+	// Links returns and forgets the spans of the changes which triggered an
+	// event for the registry, so its reconcile can link to them
+	Links(crName string) []trace.Link
+}
+
+// maxLinks bounds the spans kept per registry, e.g. when the reconcile of a
+// registry does not consume them
+const maxLinks = 64
+
+type pending struct {
+	timer *time.Timer
+	first time.Time
+	links []trace.Link
+}
+
+type trigger struct {
+	events   chan<- event.GenericEvent
+	debounce time.Duration
+	maxWait  time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]*pending
+	// fired are the span links of the sent events per registry
+	fired map[string][]trace.Link
+}
+
+// New returns a trigger which sends a generic event for the registry on the
+// events channel once no change was notified for the debounce period, or at
+// the latest maxWait after the first pending change.
+func New(events chan<- event.GenericEvent, debounce, maxWait time.Duration) Trigger {
+	return &trigger{
+		events:   events,
+		debounce: debounce,
+		maxWait:  maxWait,
+		pending:  make(map[string]*pending),
+		fired:    make(map[string][]trace.Link),
+	}
+}
+
+func (t *trigger) Notify(ctx context.Context, crName string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if p, ok := t.pending[crName]; ok {
+		p.links = appendLink(ctx, p.links)
+		// postpone the event, unless the change is pending for too long
+		if time.Since(p.first)+t.debounce <= t.maxWait {
+			p.timer.Reset(t.debounce)
+		}
+		return
+	}
+	p := &pending{first: time.Now(), links: appendLink(ctx, nil)}
+	p.timer = time.AfterFunc(t.debounce, func() { t.fire(crName, p) })
+	t.pending[crName] = p
+}
+
+func (t *trigger) Pending() map[string]time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	pending := make(map[string]time.Time, len(t.pending))
+	for crName, p := range t.pending {
+		pending[crName] = p.first
+	}
+	return pending
+}
+
+func (t *trigger) Links(crName string) []trace.Link {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	links := t.fired[crName]
+	delete(t.fired, crName)
+	return links
+}
+
+// appendLink appends the span of the context, a context without valid span is
+// skipped and the links are bounded by maxLinks
+func appendLink(ctx context.Context, links []trace.Link) []trace.Link {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || len(links) >= maxLinks {
+		return links
+	}
+	return append(links, trace.Link{SpanContext: sc})
+}
+
+func (t *trigger) fire(crName string, p *pending) {
+	t.mutex.Lock()
+	if t.pending[crName] == p {
+		delete(t.pending, crName)
+	}
+	links := t.fired[crName]
+	for _, l := range p.links {
+		if len(links) >= maxLinks {
+			break
+		}
+		links = append(links, l)
+	}
+	if len(links) > 0 {
+		t.fired[crName] = links
+	}
+	t.mutex.Unlock()
+
+	// crName is <namespace>.<name>, a namespace cannot contain a dot
+	split := strings.SplitN(crName, ".", 2)
+	if len(split) != 2 {
+		return
+	}
+	select {
+	case t.events <- event.GenericEvent{
+		Object: &niv1alpha1.Registry{
+			ObjectMeta: metav1.ObjectMeta{Namespace: split[0], Name: split[1]},
+		},
+	}:
+	default:
+		// the events are not consumed, e.g. the controller is not started,
+		// the event is retried after the debounce period instead of blocking
+		// the timer goroutine
+		t.Notify(context.Background(), crName)
+	}
+}
@@ -0,0 +1,82 @@
+package trigger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// receive returns the names of the registries of the events received within
+// the duration
+func receive(events <-chan event.GenericEvent, d time.Duration) []string {
+	names := make([]string, 0)
+	timeout := time.After(d)
+	for {
+		select {
+		case e := <-events:
+			names = append(names, e.Object.GetNamespace()+"."+e.Object.GetName())
+		case <-timeout:
+			return names
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	events := make(chan event.GenericEvent)
+	tr := New(events, 50*time.Millisecond, time.Second)
+	for i := 0; i < 5; i++ {
+		tr.Notify(context.Background(), "default.rg1")
+	}
+	tr.Notify(context.Background(), "default.rg2")
+
+	names := receive(events, 300*time.Millisecond)
+	if len(names) != 2 {
+		t.Errorf("expected one event per registry, got %v", names)
+	}
+	if len(tr.Pending()) != 0 {
+		t.Errorf("no change should be pending: %v", tr.Pending())
+	}
+}
+
+func TestMaxWait(t *testing.T) {
+	events := make(chan event.GenericEvent)
+	tr := New(events, 50*time.Millisecond, 150*time.Millisecond)
+
+	// the changes keep postponing the event, until maxWait is reached
+	start := time.Now()
+	var fired time.Duration
+	timeout := time.After(time.Second)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for fired == 0 {
+		select {
+		case <-ticker.C:
+			tr.Notify(context.Background(), "default.rg1")
+		case <-events:
+			fired = time.Since(start)
+		case <-timeout:
+			t.Fatalf("no event within a second")
+		}
+	}
+	if fired > 500*time.Millisecond {
+		t.Errorf("the event should fire around maxWait, got %v", fired)
+	}
+}
+
+func TestNotConsumed(t *testing.T) {
+	events := make(chan event.GenericEvent)
+	tr := New(events, 20*time.Millisecond, time.Second)
+	tr.Notify(context.Background(), "default.rg1")
+
+	// nobody receives, the event is retried instead of blocking
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := tr.Pending()["default.rg1"]; !ok {
+		t.Errorf("the event should be pending again")
+	}
+
+	if names := receive(events, 200*time.Millisecond); len(names) != 1 {
+		t.Errorf("expected the retried event, got %v", names)
+	}
+}